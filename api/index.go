@@ -5,8 +5,10 @@ import (
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/j178/github_stargazer/backend/routes/badge"
 	"github.com/j178/github_stargazer/backend/routes/configure"
 	"github.com/j178/github_stargazer/backend/routes/discord"
+	"github.com/j178/github_stargazer/backend/routes/feed"
 	"github.com/j178/github_stargazer/backend/routes/github"
 	"github.com/j178/github_stargazer/backend/routes/telegram"
 
@@ -36,6 +38,14 @@ func initRouter() *gin.Engine {
 		// GitHub webhook
 		r.POST("/api/webhook/github", github.OnEvent)
 	}
+	// Public star badges
+	{
+		r.GET("/api/badge/:owner/:repo", badge.Badge)
+	}
+	// Feeds of the recent stargazers, protected by the feed token
+	{
+		r.GET("/api/feed/:account", feed.Feed)
+	}
 	// Configure UI API
 	{
 		checkJWT := middleware.CheckJWT(config.SecretKey)
@@ -44,12 +54,26 @@ func initRouter() *gin.Engine {
 		admin.GET("/api/settings/:account", configure.GetSettings)
 		admin.POST("/api/settings/:account", configure.UpdateSettings)
 		admin.DELETE("/api/settings/:account", configure.DeleteSettings)
+		admin.POST("/api/settings/:account/feed_token", configure.RegenerateFeedToken)
 		admin.POST("/api/settings/check", configure.CheckSettings)
 		admin.POST("/api/settings/test", configure.TestNotify)
 		admin.GET("/api/repos/:installationID", configure.InstalledRepos)
 		admin.GET("/api/repos/:installationID/search", configure.SearchInstalledRepos)
+		admin.POST("/api/repos/:installationID/filter", configure.FilterInstalledRepos)
+		admin.POST("/api/repos/:installationID/backfill", configure.QueueBackfill)
 		admin.POST("/api/connect/:platform", configure.GenerateConnectToken)
 		admin.GET("/api/connect/:platform/:token", configure.GetConnectResult)
+		admin.GET("/api/outbox/:account/dead", configure.GetDeadLetters)
+		admin.POST("/api/outbox/:account/dead/:id/replay", configure.ReplayDeadLetter)
+		admin.GET("/api/stats/:account/:repo", configure.GetStats)
+		admin.GET("/api/suspicion/:account/:repo", configure.GetSuspicion)
+		admin.GET("/api/export/:account", configure.Export)
+		admin.GET("/api/events/:account", configure.Events)
+	}
+	// Vercel Cron
+	{
+		cron := r.Group("", middleware.CheckCronSecret(config.CronSecret))
+		cron.GET("/api/cron/:task", github.OnCron)
 	}
 	// Telegram webhook
 	{
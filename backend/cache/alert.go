@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// The alerts are claimed before they are sent, so that an alert of a repo is sent once per cooldown for a login,
+// and released if they failed to be sent, so that the retries claim them again.
+
+// ClaimAlert starts the cooldown of the alerts of the kind on the repo for the login, returns false if it's cooling down.
+func ClaimAlert(ctx context.Context, kind, repo, login string, cooldown time.Duration) (bool, error) {
+	return SetNX(ctx, Key{kind, repo, login}, time.Now().Unix(), cooldown)
+}
+
+// ReleaseAlert ends the cooldown, used when the alert failed to be sent.
+func ReleaseAlert(ctx context.Context, kind, repo, login string) error {
+	return Delete(ctx, Key{kind, repo, login})
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// the avatar of an account rarely changes, and its URL changes with it
+	avatarExpire = 7 * 24 * time.Hour
+	// larger images are not identicons
+	maxAvatarSize = 1 << 20
+)
+
+// identiconBackground is the background color of the identicons, the default avatars of GitHub.
+var identiconBackground = color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+
+// IsIdenticon reports whether the image looks like an identicon: the background and a single color of the pattern.
+func IsIdenticon(img image.Image) bool {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 || bounds.Dx() != bounds.Dy() {
+		return false
+	}
+	colors := make(map[color.RGBA]bool)
+	// the blocks of the pattern are large, the samples don't miss them
+	step := max(1, bounds.Dx()/70)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			colors[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)] = true
+			if len(colors) > 2 {
+				return false
+			}
+		}
+	}
+	return len(colors) == 2 && colors[identiconBackground]
+}
+
+// IsDefaultAvatar reports whether the avatar is the identicon GitHub gives to the accounts without one.
+// The API serves the identicons from the same URLs as the uploaded avatars, so the image is fetched and cached.
+func IsDefaultAvatar(ctx context.Context, avatarURL string) (bool, error) {
+	if avatarURL == "" {
+		return false, nil
+	}
+	return GetOrCreate(
+		ctx, Key{"default_avatar", avatarURL}, avatarExpire, func() (bool, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, avatarURL, nil)
+			if err != nil {
+				return false, err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return false, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return false, fmt.Errorf("get avatar: %s", resp.Status)
+			}
+			img, _, err := image.Decode(io.LimitReader(resp.Body, maxAvatarSize))
+			if err != nil {
+				// not an image we can tell
+				return false, nil
+			}
+			return IsIdenticon(img), nil
+		},
+	)
+}
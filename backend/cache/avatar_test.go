@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// identicon draws a 5x5 pattern of the color on the identicon background, like the default avatars.
+func identicon(size int, fg color.RGBA, blocks [5][5]bool) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	margin := size / 12
+	block := (size - 2*margin) / 5
+	for y := range size {
+		for x := range size {
+			img.Set(x, y, identiconBackground)
+			bx, by := (x-margin)/block, (y-margin)/block
+			if x >= margin && y >= margin && bx < 5 && by < 5 && blocks[by][bx] {
+				img.Set(x, y, fg)
+			}
+		}
+	}
+	return img
+}
+
+func TestIsIdenticon(t *testing.T) {
+	pattern := [5][5]bool{
+		{true, false, true, false, true},
+		{false, true, true, true, false},
+		{true, true, false, true, true},
+		{false, false, true, false, false},
+		{true, false, false, false, true},
+	}
+	photo := image.NewRGBA(image.Rect(0, 0, 420, 420))
+	for y := range 420 {
+		for x := range 420 {
+			photo.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 0xff})
+		}
+	}
+	threeColors := identicon(420, color.RGBA{R: 0x4c, G: 0xa0, B: 0x6e, A: 0xff}, pattern)
+	threeColors.Set(0, 0, color.RGBA{A: 0xff})
+	otherBackground := image.NewRGBA(image.Rect(0, 0, 420, 420))
+	for y := range 420 {
+		for x := range 420 {
+			otherBackground.Set(x, y, color.RGBA{R: uint8(x / 210 * 255), A: 0xff})
+		}
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+		want bool
+	}{
+		{"identicon", identicon(420, color.RGBA{R: 0xb3, G: 0x5a, B: 0xd1, A: 0xff}, pattern), true},
+		{"small identicon", identicon(40, color.RGBA{R: 0x2e, G: 0x8b, B: 0x57, A: 0xff}, pattern), true},
+		{"photo", photo, false},
+		{"three colors", threeColors, false},
+		{"two colors without the background", otherBackground, false},
+		{"not square", image.NewRGBA(image.Rect(0, 0, 420, 200)), false},
+		{"empty", image.NewRGBA(image.Rect(0, 0, 0, 0)), false},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := IsIdenticon(tt.img); got != tt.want {
+					t.Errorf("IsIdenticon() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// The star history of the repos of new installations is backfilled from the stargazers API.
+// Installations waiting to be backfilled are kept in a set, the progress of each repo is kept in its cursor.
+
+// BackfillCursor is the progress of backfilling a repo.
+type BackfillCursor struct {
+	// Next page of the stargazers, oldest first
+	Page int `json:"page"`
+	// Only the stars before it are backfilled, the later ones are recorded by the webhook
+	Until int64 `json:"until"`
+	Done  bool  `json:"done"`
+}
+
+// QueueBackfill adds the installation to be backfilled.
+func QueueBackfill(ctx context.Context, installationID int64) error {
+	redis := Redis()
+	cmd := redis.B().Sadd().Key(Key{"backfill", "pending"}.String()).Member(strconv.FormatInt(installationID, 10)).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// PendingBackfills returns the installations waiting to be backfilled.
+func PendingBackfills(ctx context.Context) ([]int64, error) {
+	redis := Redis()
+	cmd := redis.B().Smembers().Key(Key{"backfill", "pending"}.String()).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// FinishBackfill removes the installation from the pending ones.
+func FinishBackfill(ctx context.Context, installationID int64) error {
+	redis := Redis()
+	cmd := redis.B().Srem().Key(Key{"backfill", "pending"}.String()).Member(strconv.FormatInt(installationID, 10)).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// PauseBackfill pauses the backfill of the installation until the rate limit is reset.
+func PauseBackfill(ctx context.Context, installationID int64, until time.Time) error {
+	expire := time.Until(until)
+	if expire < time.Second {
+		expire = time.Second
+	}
+	return Set(ctx, Key{"backfill", "paused", strconv.FormatInt(installationID, 10)}, until.Unix(), expire)
+}
+
+// BackfillPaused reports whether the backfill of the installation is paused.
+func BackfillPaused(ctx context.Context, installationID int64) (bool, error) {
+	_, err := Get[int64](ctx, Key{"backfill", "paused", strconv.FormatInt(installationID, 10)})
+	if errors.Is(err, ErrCacheMiss) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func GetBackfillCursor(ctx context.Context, repo string) (BackfillCursor, error) {
+	cursor, err := Get[BackfillCursor](ctx, Key{"backfill", "cursor", repo})
+	if errors.Is(err, ErrCacheMiss) {
+		return BackfillCursor{}, nil
+	}
+	return cursor, err
+}
+
+func SaveBackfillCursor(ctx context.Context, repo string, cursor BackfillCursor) error {
+	return Set(ctx, Key{"backfill", "cursor", repo}, cursor, FOREVER)
+}
+
+// FirstStarRecord returns the oldest record in the history of the repo, nil if there is none.
+func FirstStarRecord(ctx context.Context, repo string) (*StarRecord, error) {
+	redis := Redis()
+	cmd := redis.B().Zrange().Key(Key{"history", repo}.String()).Min("0").Max("0").Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return nil, err
+	}
+	records := parseStarRecords(members)
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const (
+	// the star counts of the badges are refreshed at this interval
+	BadgeExpire = 10 * time.Minute
+	// the repos failed to fetch are not tried again in this interval, the badges are public
+	badgeFailureExpire = 5 * time.Minute
+)
+
+var ErrRepoUnavailable = fmt.Errorf("cache: repo unavailable")
+
+type RepoStars struct {
+	RepoInfo
+	Stars int
+}
+
+// GetRepoStars returns the repo with its star count, fetched with the installation token on the repo.
+// The failures are cached for a while too, returning ErrRepoUnavailable.
+func GetRepoStars(ctx context.Context, repo string) (RepoStars, error) {
+	failed, err := Get[string](ctx, Key{"repo_stars", "failed", repo})
+	if err == nil {
+		return RepoStars{}, fmt.Errorf("%w: %s", ErrRepoUnavailable, failed)
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		return RepoStars{}, err
+	}
+
+	return GetOrCreate(
+		ctx, Key{"repo_stars", repo}, BadgeExpire, func() (RepoStars, error) {
+			stars, err := fetchRepoStars(ctx, repo)
+			if err != nil && ctx.Err() == nil {
+				_ = Set(ctx, Key{"repo_stars", "failed", repo}, err.Error(), badgeFailureExpire)
+			}
+			return stars, err
+		},
+	)
+}
+
+func fetchRepoStars(ctx context.Context, repo string) (RepoStars, error) {
+	installationID, err := GetRepoInstallationID(ctx, repo)
+	if err != nil {
+		return RepoStars{}, err
+	}
+	token, err := GetInstallationToken(ctx, installationID)
+	if err != nil {
+		return RepoStars{}, err
+	}
+
+	client := github.NewTokenClient(ctx, token)
+	owner, name, _ := strings.Cut(repo, "/")
+	r, _, err := client.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return RepoStars{}, err
+	}
+	return RepoStars{
+		RepoInfo: RepoInfo{
+			FullName: r.GetFullName(),
+			Fork:     r.GetFork(),
+			Archived: r.GetArchived(),
+			Private:  r.GetPrivate(),
+		},
+		Stars: r.GetStargazersCount(),
+	}, nil
+}
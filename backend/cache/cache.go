@@ -44,6 +44,9 @@ type CacheStore interface {
 	Delete(ctx context.Context, key string) error
 
 	Incr(ctx context.Context, key string, value *int64, expires time.Duration) error
+
+	// SetNX sets an item only if the key does not exist yet. Returns whether the item was set.
+	SetNX(ctx context.Context, key string, value interface{}, expires time.Duration) (bool, error)
 }
 
 type redisCache struct {
@@ -88,6 +91,31 @@ func (c *redisCache) Delete(ctx context.Context, key string) error {
 	return err
 }
 
+func (c *redisCache) SetNX(ctx context.Context, key string, value interface{}, expires time.Duration) (bool, error) {
+	if expires == DEFAULT {
+		expires = c.defaultExpiration
+	}
+
+	v, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	var cmd rueidis.Completed
+	if expires > 0 {
+		cmd = c.redis.B().Set().Key(key).Value(string(v)).Nx().Ex(expires).Build()
+	} else {
+		cmd = c.redis.B().Set().Key(key).Value(string(v)).Nx().Build()
+	}
+	err = c.redis.Do(ctx, cmd).Error()
+	if rueidis.IsRedisNil(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (c *redisCache) Incr(ctx context.Context, key string, value *int64, expires time.Duration) error {
 	if expires == DEFAULT {
 		expires = c.defaultExpiration
@@ -177,6 +205,10 @@ func Set[T any](ctx context.Context, key Key, value T, expire time.Duration) err
 	return Default().Set(ctx, key.String(), value, expire)
 }
 
+func SetNX[T any](ctx context.Context, key Key, value T, expire time.Duration) (bool, error) {
+	return Default().SetNX(ctx, key.String(), value, expire)
+}
+
 func Delete(ctx context.Context, key Key) error {
 	return Default().Delete(ctx, key.String())
 }
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+type DeliveryStatus string
+
+const (
+	DeliveryProcessing DeliveryStatus = "processing"
+	DeliveryQueued     DeliveryStatus = "queued"
+	DeliverySucceeded  DeliveryStatus = "succeeded"
+	DeliveryFailed     DeliveryStatus = "failed"
+)
+
+const (
+	// GitHub only keeps deliveries of the past 3 days, older ones can't be redelivered.
+	DeliveryExpire = 3 * 24 * time.Hour
+	// 处理中的记录超过这个时间还没有结果，认为处理过程已经中断，允许重新处理
+	deliveryProcessingExpire = 5 * time.Minute
+)
+
+// Delivery records the processing outcome of a webhook delivery, keyed by `X-GitHub-Delivery`.
+type Delivery struct {
+	Status DeliveryStatus `json:"status"`
+	// Channels that failed to receive the notification, only these are retried on redelivery.
+	Failed    []string `json:"failed,omitempty"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+// BeginDelivery claims the delivery for processing.
+// It returns the previous record if the delivery has been seen before, and whether the caller should process it.
+// Only deliveries that have never been seen, or that have failed before, are processed.
+func BeginDelivery(ctx context.Context, guid string) (*Delivery, bool, error) {
+	if guid == "" {
+		return nil, true, nil
+	}
+	key := Key{"delivery", guid}
+	record := Delivery{Status: DeliveryProcessing, UpdatedAt: time.Now().Unix()}
+
+	ok, err := SetNX(ctx, key, record, deliveryProcessingExpire)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return nil, true, nil
+	}
+
+	prev, err := Get[Delivery](ctx, key)
+	if err == ErrCacheMiss {
+		// expired in between, just process it
+		return nil, true, Set(ctx, key, record, deliveryProcessingExpire)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if prev.Status != DeliveryFailed {
+		return &prev, false, nil
+	}
+
+	record.Failed = prev.Failed
+	err = Set(ctx, key, record, deliveryProcessingExpire)
+	if err != nil {
+		return nil, false, err
+	}
+	return &prev, true, nil
+}
+
+// QueueDelivery records that the delivery is waiting in the outbox.
+func QueueDelivery(ctx context.Context, guid string) error {
+	if guid == "" {
+		return nil
+	}
+	record := Delivery{Status: DeliveryQueued, UpdatedAt: time.Now().Unix()}
+	return Set(ctx, Key{"delivery", guid}, record, DeliveryExpire)
+}
+
+// FinishDelivery records that the delivery has been processed successfully.
+func FinishDelivery(ctx context.Context, guid string) error {
+	if guid == "" {
+		return nil
+	}
+	record := Delivery{Status: DeliverySucceeded, UpdatedAt: time.Now().Unix()}
+	return Set(ctx, Key{"delivery", guid}, record, DeliveryExpire)
+}
+
+// FailDelivery records that the delivery has failed on the given channels, nil means all channels.
+func FailDelivery(ctx context.Context, guid string, failed []string) error {
+	if guid == "" {
+		return nil
+	}
+	record := Delivery{Status: DeliveryFailed, Failed: failed, UpdatedAt: time.Now().Unix()}
+	return Set(ctx, Key{"delivery", guid}, record, DeliveryExpire)
+}
+
+// AbortDelivery forgets the delivery, so that a redelivery will be processed from scratch.
+func AbortDelivery(ctx context.Context, guid string) error {
+	if guid == "" {
+		return nil
+	}
+	return Delete(ctx, Key{"delivery", guid})
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// Events of the channels in digest mode are accumulated in a list per channel,
+// and the channels waiting to be flushed are kept in a sorted set scored by their due time.
+
+// maxDigestEntries limits the entries flushed in one digest
+const maxDigestEntries = 10000
+
+type DigestEntry struct {
+	Repo      string `json:"repo"`
+	RepoURL   string `json:"repo_url"`
+	Action    string `json:"action"`
+	Sender    string `json:"sender"`
+	SenderURL string `json:"sender_url"`
+	Stars     int    `json:"stars"`
+	At        int64  `json:"at"`
+	// Markdown line of the events other than star and unstar
+	Summary string `json:"summary,omitempty"`
+}
+
+// DigestChannel identifies the channel of an account that has a pending digest.
+type DigestChannel struct {
+	Account string
+	Channel string
+}
+
+func (d DigestChannel) member() string {
+	return d.Account + "/" + d.Channel
+}
+
+// AddDigest appends the entry to the digest of the channel, which will be due at `due` if it is the first entry.
+func AddDigest(ctx context.Context, ch DigestChannel, due time.Time, entry DigestEntry) error {
+	v, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	redis := Redis()
+	cmd := redis.B().Rpush().Key(Key{"digest", ch.Account, ch.Channel}.String()).Element(string(v)).Build()
+	err = redis.Do(ctx, cmd).Error()
+	if err != nil {
+		return err
+	}
+	return ScheduleDigest(ctx, ch, due)
+}
+
+// ScheduleDigest schedules the digest of the channel to be flushed at `due`, if it's not scheduled yet.
+func ScheduleDigest(ctx context.Context, ch DigestChannel, due time.Time) error {
+	redis := Redis()
+	cmd := redis.B().Zadd().Key(Key{"digest", "pending"}.String()).Nx().ScoreMember().
+		ScoreMember(float64(due.Unix()), ch.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// DelayDigest moves the pending digest of the channel to `due`, it does nothing if the digest is already taken.
+func DelayDigest(ctx context.Context, ch DigestChannel, due time.Time) error {
+	redis := Redis()
+	cmd := redis.B().Zadd().Key(Key{"digest", "pending"}.String()).Xx().ScoreMember().
+		ScoreMember(float64(due.Unix()), ch.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// DueDigests returns the channels whose digests are due, they stay pending until taken by TakeDigest.
+func DueDigests(ctx context.Context, now time.Time) ([]DigestChannel, error) {
+	redis := Redis()
+	key := Key{"digest", "pending"}.String()
+	cmd := redis.B().Zrangebyscore().Key(key).Min("-inf").Max(strconv.FormatInt(now.Unix(), 10)).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []DigestChannel
+	for _, member := range members {
+		account, channel, ok := strings.Cut(member, "/")
+		if !ok {
+			continue
+		}
+		channels = append(channels, DigestChannel{Account: account, Channel: channel})
+	}
+	return channels, nil
+}
+
+// takeDigestScript unschedules the due digest and pops its entries in one go,
+// and schedules it again right away if there are more entries than a digest can take.
+// KEYS: pending set, entry list; ARGV: member, now, max entries.
+var takeDigestScript = rueidis.NewLuaScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return {}
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local vals = redis.call('LPOP', KEYS[2], ARGV[3])
+if not vals then
+	return {}
+end
+if redis.call('LLEN', KEYS[2]) > 0 then
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+end
+return vals
+`)
+
+// TakeDigest removes and returns the accumulated entries of the channel if its digest is due,
+// at most maxDigestEntries of them. It returns nothing if the digest is not due or taken by another worker.
+func TakeDigest(ctx context.Context, ch DigestChannel, now time.Time) ([]DigestEntry, error) {
+	keys := []string{Key{"digest", "pending"}.String(), Key{"digest", ch.Account, ch.Channel}.String()}
+	args := []string{ch.member(), strconv.FormatInt(now.Unix(), 10), strconv.Itoa(maxDigestEntries)}
+	vals, err := takeDigestScript.Exec(ctx, Redis(), keys, args).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]DigestEntry, 0, len(vals))
+	for _, v := range vals {
+		var entry DigestEntry
+		if err := json.Unmarshal([]byte(v), &entry); err != nil {
+			// it would never decode, don't let it hold back the others
+			log.Printf("digest: drop malformed entry of %s: %v", ch.Channel, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// RequeueDigest puts the taken entries back at the head of the digest of the channel, in their order,
+// and schedules it at `due`, or earlier if it's already scheduled so.
+func RequeueDigest(ctx context.Context, ch DigestChannel, due time.Time, entries []DigestEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	vals := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		v, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		vals = append(vals, string(v))
+	}
+
+	redis := Redis()
+	// LPUSH prepends in reverse order
+	slices.Reverse(vals)
+	err := redis.Do(ctx, redis.B().Lpush().Key(Key{"digest", ch.Account, ch.Channel}.String()).Element(vals...).Build()).Error()
+	if err != nil {
+		return err
+	}
+	cmd := redis.B().Zadd().Key(Key{"digest", "pending"}.String()).Lt().ScoreMember().
+		ScoreMember(float64(due.Unix()), ch.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
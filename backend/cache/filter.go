@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Entries of AllowRepos and MuteRepos can be:
+//   - an exact name: `owner/repo`
+//   - a glob: `org/sdk-*`, see path.Match
+//   - an anchored regex: `re:^org/(api|web)$`
+
+const regexPrefix = "re:"
+
+// RepoInfo is the repo metadata the repo filters are evaluated against.
+type RepoInfo struct {
+	FullName string
+	Fork     bool
+	Archived bool
+	Private  bool
+}
+
+var regexCache sync.Map
+
+func compileRepoRegex(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	// always anchored, so that `org/api` doesn't match `org/api-legacy`
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// MatchRepo reports whether the repo full name matches the pattern.
+func MatchRepo(pattern, fullName string) bool {
+	if re, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		r, err := compileRepoRegex(re)
+		return err == nil && r.MatchString(fullName)
+	}
+	if pattern == fullName {
+		return true
+	}
+	matched, err := path.Match(pattern, fullName)
+	return err == nil && matched
+}
+
+func validateRepoPattern(pattern string) error {
+	if re, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		if _, err := compileRepoRegex(re); err != nil {
+			return fmt.Errorf("invalid repo regex %q: %w", pattern, err)
+		}
+		return nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid repo pattern %q: %w", pattern, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Star and unstar of the same sender on the same repo in a short time are considered flapping.
+// The star events of the settings with a debounce window are held for the window, and canceled
+// together with the unstar event if it comes before the held star is sent. Restars within a day are ignored.
+
+const (
+	// MaxDebounce is the max debounce window of a setting
+	MaxDebounce = 10 * time.Minute
+	// the held jobs may be run a bit later than the window
+	flapGrace    = 10 * time.Minute
+	restarWindow = 24 * time.Hour
+)
+
+const (
+	FlapStar   = "star"
+	FlapUnstar = "unstar"
+)
+
+type Flap struct {
+	StarredAt   int64 `json:"starred_at"`
+	UnstarredAt int64 `json:"unstarred_at,omitempty"`
+}
+
+func flapKey(repo, sender string) Key {
+	return Key{"flap", repo, sender}
+}
+
+func restarKey(repo, sender string) Key {
+	return Key{"restar", repo, sender}
+}
+
+// RecordStar records the star of the sender on the repo.
+// Returns the number of stars of the sender on the repo in the last day, including this one.
+func RecordStar(ctx context.Context, repo, sender string, now time.Time) (int64, error) {
+	err := Set(ctx, flapKey(repo, sender), Flap{StarredAt: now.Unix()}, MaxDebounce+flapGrace)
+	if err != nil {
+		return 0, err
+	}
+	return Incr(ctx, restarKey(repo, sender), restarWindow)
+}
+
+// GetFlap returns the recent star of the sender on the repo, nil if there is none.
+func GetFlap(ctx context.Context, repo, sender string) (*Flap, error) {
+	flap, err := Get[Flap](ctx, flapKey(repo, sender))
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flap, nil
+}
+
+// RecordUnstar marks the recent star of the sender on the repo as unstarred.
+// Returns the recent star (nil if there is none), and the number of stars of the sender on the repo in the last day.
+func RecordUnstar(ctx context.Context, repo, sender string, now time.Time) (*Flap, int64, error) {
+	flap, err := GetFlap(ctx, repo, sender)
+	if err != nil {
+		return nil, 0, err
+	}
+	if flap != nil && flap.UnstarredAt == 0 {
+		flap.UnstarredAt = now.Unix()
+		err = Set(ctx, flapKey(repo, sender), *flap, MaxDebounce+flapGrace)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	stars, err := Get[int64](ctx, restarKey(repo, sender))
+	if err != nil && !errors.Is(err, ErrCacheMiss) {
+		return nil, 0, err
+	}
+	return flap, stars, nil
+}
+
+// DecideFlap settles which of the held star of the window and its unstar comes first, the first decision wins.
+// So the star and the unstar are either both notified in order, or both dropped.
+func DecideFlap(ctx context.Context, repo, sender string, starredAt int64, window time.Duration, decision string) (
+	string,
+	error,
+) {
+	key := Key{
+		"flap_decision", repo, sender, strconv.FormatInt(starredAt, 10), strconv.Itoa(int(window / time.Second)),
+	}
+	ok, err := SetNX(ctx, key, decision, restarWindow)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return decision, nil
+	}
+	return Get[string](ctx, key)
+}
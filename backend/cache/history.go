@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryRetention is how long the star records of a repo are kept.
+const HistoryRetention = 2 * 365 * 24 * time.Hour
+
+// StarRecord is a star event of a repo, kept in a sorted set per repo scored by the time.
+type StarRecord struct {
+	Action string `json:"action"`
+	Sender string `json:"sender"`
+	// Stars of the repo after the event
+	Stars int   `json:"stars"`
+	At    int64 `json:"at"`
+}
+
+// AddStarRecord appends the record to the history of the repo, and drops the records older than HistoryRetention.
+// Adding the same record again is a no-op.
+func AddStarRecord(ctx context.Context, repo string, record StarRecord) error {
+	return AddStarRecords(ctx, repo, []StarRecord{record})
+}
+
+// AddStarRecords is like AddStarRecord, but adds the records at once.
+func AddStarRecords(ctx context.Context, repo string, records []StarRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	redis := Redis()
+	key := Key{"history", repo}.String()
+	cmd := redis.B().Zadd().Key(key).ScoreMember()
+	for _, record := range records {
+		v, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		cmd = cmd.ScoreMember(float64(record.At), string(v))
+	}
+	expired := time.Now().Add(-HistoryRetention).Unix()
+	owner, _, _ := strings.Cut(repo, "/")
+	for _, resp := range redis.DoMulti(
+		ctx,
+		cmd.Build(),
+		redis.B().Sadd().Key(Key{"history_repos", owner}.String()).Member(repo).Build(),
+		redis.B().Zremrangebyscore().Key(key).Min("-inf").Max("("+strconv.FormatInt(expired, 10)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStarHistory returns the records of the repo in [from, to], oldest first.
+func GetStarHistory(ctx context.Context, repo string, from, to time.Time) ([]StarRecord, error) {
+	redis := Redis()
+	cmd := redis.B().Zrangebyscore().Key(Key{"history", repo}.String()).
+		Min(strconv.FormatInt(from.Unix(), 10)).Max(strconv.FormatInt(to.Unix(), 10)).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	return parseStarRecords(members), nil
+}
+
+func parseStarRecords(members []string) []StarRecord {
+	records := make([]StarRecord, 0, len(members))
+	for _, member := range members {
+		var record StarRecord
+		if err := json.Unmarshal([]byte(member), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// HistoryRepos returns the repos of the account that have star history.
+func HistoryRepos(ctx context.Context, account string) ([]string, error) {
+	redis := Redis()
+	cmd := redis.B().Smembers().Key(Key{"history_repos", account}.String()).Build()
+	return redis.Do(ctx, cmd).AsStrSlice()
+}
+
+// LastStarRecord returns the latest record in the history of the repo, nil if there is none.
+func LastStarRecord(ctx context.Context, repo string) (*StarRecord, error) {
+	redis := Redis()
+	cmd := redis.B().Zrange().Key(Key{"history", repo}.String()).Min("-1").Max("-1").Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+	records := parseStarRecords(members)
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
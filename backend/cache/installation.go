@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"strconv"
+)
+
+// InstallationsKey caches the accounts that the app is installed to and the login has access to.
+func InstallationsKey(login string) Key {
+	return Key{"installations", login}
+}
+
+// InstallationReposKey caches the repos that the installation has access to.
+func InstallationReposKey(installationID int64) Key {
+	return Key{"installation_repos", strconv.FormatInt(installationID, 10)}
+}
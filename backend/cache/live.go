@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+const (
+	LiveStar  = "star"
+	LiveEvent = "event"
+	LiveTest  = "test"
+
+	// the latest messages kept for the subscribers to catch up after reconnecting
+	maxLiveMessages = 100
+	liveExpire      = time.Hour
+)
+
+// LiveMessage is a processed event and its delivery result, pushed to the live stream of the account.
+type LiveMessage struct {
+	Type       string `json:"type"`
+	DeliveryID string `json:"delivery_id,omitempty"`
+	// GitHub event name
+	Event  string `json:"event,omitempty"`
+	Action string `json:"action,omitempty"`
+	Repo   string `json:"repo,omitempty"`
+	Sender string `json:"sender,omitempty"`
+	// delivered, retrying, dead, or sent and failed for the test sends
+	Status string `json:"status"`
+	// Channels that failed to be delivered
+	Failed   []string `json:"failed,omitempty"`
+	Error    string   `json:"error,omitempty"`
+	Attempts int      `json:"attempts,omitempty"`
+	At       int64    `json:"at"`
+}
+
+// LiveEntry is a message in the live stream, the ID is the Last-Event-ID to resume from.
+type LiveEntry struct {
+	ID      string
+	Message LiveMessage
+}
+
+func liveStream(account string) string {
+	return Key{"live", account}.String()
+}
+
+// PublishLive appends the message to the live stream of the account, only the latest messages are kept
+// for the reconnecting subscribers.
+func PublishLive(ctx context.Context, account string, msg LiveMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	redis := Redis()
+	key := liveStream(account)
+	for _, resp := range redis.DoMulti(
+		ctx,
+		redis.B().Xadd().Key(key).Maxlen().Almost().Threshold(strconv.Itoa(maxLiveMessages)).Id("*").
+			FieldValue().FieldValue("msg", string(data)).Build(),
+		redis.B().Expire().Key(key).Seconds(int64(liveExpire/time.Second)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LatestLiveID returns the ID of the latest message in the live stream of the account, to read the new ones after it.
+func LatestLiveID(ctx context.Context, account string) (string, error) {
+	redis := Redis()
+	cmd := redis.B().Xrevrange().Key(liveStream(account)).End("+").Start("-").Count(1).Build()
+	entries, err := redis.Do(ctx, cmd).AsXRange()
+	if err != nil && !rueidis.IsRedisNil(err) {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+	return entries[0].ID, nil
+}
+
+// ReadLive returns the messages of the account after the ID, waiting up to `block` for new ones.
+func ReadLive(ctx context.Context, account, after string, block time.Duration) ([]LiveEntry, error) {
+	redis := Redis()
+	key := liveStream(account)
+	cmd := redis.B().Xread().Count(maxLiveMessages).Block(block.Milliseconds()).Streams().Key(key).Id(after).Build()
+	streams, err := redis.Do(ctx, cmd).AsXRead()
+	if rueidis.IsRedisNil(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]LiveEntry, 0, len(streams[key]))
+	for _, entry := range streams[key] {
+		var msg LiveMessage
+		if err := json.Unmarshal([]byte(entry.FieldValues["msg"]), &msg); err != nil {
+			continue
+		}
+		result = append(result, LiveEntry{ID: entry.ID, Message: msg})
+	}
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// MilestoneRule decides which star counts of a repo are worth a notification.
+type MilestoneRule struct {
+	// Every N stars
+	Every int `json:"every,omitempty"`
+	// Round numbers: 100, 1000, 10000, ...
+	Round  bool  `json:"round,omitempty"`
+	Custom []int `json:"custom,omitempty"`
+	ChannelSelector
+}
+
+// Prev returns the highest milestone at or below the star count, 0 if there is none.
+func (r *MilestoneRule) Prev(stars int) int {
+	if r == nil || stars <= 0 {
+		return 0
+	}
+	prev := 0
+	if r.Every > 0 {
+		prev = stars / r.Every * r.Every
+	}
+	if r.Round && stars >= 100 {
+		n := 100
+		for n*10 <= stars {
+			n *= 10
+		}
+		prev = max(prev, n)
+	}
+	for _, n := range r.Custom {
+		if n <= stars {
+			prev = max(prev, n)
+		}
+	}
+	return prev
+}
+
+// Next returns the next milestone after the star count, the next round number if there is no rule.
+func (r *MilestoneRule) Next(stars int) int {
+	next := 100
+	for next <= stars {
+		next *= 10
+	}
+	if r == nil {
+		return next
+	}
+	if !r.Round {
+		next = 0
+	}
+	if r.Every > 0 {
+		n := (stars/r.Every + 1) * r.Every
+		if next == 0 || n < next {
+			next = n
+		}
+	}
+	for _, n := range r.Custom {
+		if n > stars && (next == 0 || n < next) {
+			next = n
+		}
+	}
+	return next
+}
+
+func (r *MilestoneRule) validate(setting *Setting) error {
+	if r.Every < 0 {
+		return fmt.Errorf("invalid milestone every: %d", r.Every)
+	}
+	for _, n := range r.Custom {
+		if n <= 0 {
+			return fmt.Errorf("invalid custom milestone: %d", n)
+		}
+	}
+	return r.ChannelSelector.validate(setting)
+}
+
+// ClaimMilestone claims the highest milestone the repo has passed since the last one claimed for the login.
+// It returns the milestone, 0 if there is none, and the last one claimed before it to release on failures.
+// Milestones are never claimed twice, so star churn around them doesn't notify again.
+// The first claim of a repo only counts the milestones after the previous star.
+func ClaimMilestone(ctx context.Context, rule *MilestoneRule, repo, login string, stars int) (int, int, error) {
+	key := Key{"milestone", repo, login}
+	last, err := Get[int](ctx, key)
+	if errors.Is(err, ErrCacheMiss) {
+		last = rule.Prev(stars - 1)
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	m := rule.Prev(stars)
+	if m <= last {
+		return 0, last, nil
+	}
+	ok, err := SetNX(ctx, Key{"milestone", repo, login, strconv.Itoa(m)}, true, FOREVER)
+	if err != nil || !ok {
+		return 0, last, err
+	}
+	return m, last, Set(ctx, key, m, FOREVER)
+}
+
+// ReleaseMilestone forgets the milestone and restores the last one, used when it failed to be notified.
+func ReleaseMilestone(ctx context.Context, repo, login string, milestone, last int) error {
+	return errors.Join(
+		Delete(ctx, Key{"milestone", repo, login, strconv.Itoa(milestone)}),
+		Set(ctx, Key{"milestone", repo, login}, last, FOREVER),
+	)
+}
@@ -0,0 +1,39 @@
+package cache
+
+import "testing"
+
+func TestMilestoneRulePrevNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  *MilestoneRule
+		stars int
+		prev  int
+		next  int
+	}{
+		{"no rule", nil, 250, 0, 1000},
+		{"no rule below 100", nil, 42, 0, 100},
+		{"no stars", &MilestoneRule{Every: 50}, 0, 0, 50},
+		{"every", &MilestoneRule{Every: 50}, 120, 100, 150},
+		{"every at a milestone", &MilestoneRule{Every: 50}, 150, 150, 200},
+		{"round", &MilestoneRule{Round: true}, 4200, 1000, 10000},
+		{"round below 100", &MilestoneRule{Round: true}, 99, 0, 100},
+		{"round at a milestone", &MilestoneRule{Round: true}, 1000, 1000, 10000},
+		{"every and round", &MilestoneRule{Every: 300, Round: true}, 950, 900, 1000},
+		{"custom", &MilestoneRule{Custom: []int{42, 500}}, 100, 42, 500},
+		{"custom passed", &MilestoneRule{Custom: []int{42, 500}}, 600, 500, 0},
+		{"custom before every", &MilestoneRule{Every: 100, Custom: []int{123}}, 110, 100, 123},
+		{"empty rule", &MilestoneRule{}, 1000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if got := tt.rule.Prev(tt.stars); got != tt.prev {
+					t.Errorf("Prev(%d) = %d, want %d", tt.stars, got, tt.prev)
+				}
+				if got := tt.rule.Next(tt.stars); got != tt.next {
+					t.Errorf("Next(%d) = %d, want %d", tt.stars, got, tt.next)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// NotableRule picks the stargazers worth a special alert, which bypasses the digests and quiet hours.
+type NotableRule struct {
+	MinFollowers int `json:"min_followers,omitempty"`
+	// Public members of these orgs
+	Orgs      []string `json:"orgs,omitempty"`
+	Watchlist []string `json:"watchlist,omitempty"`
+	// Repos to alert, in the patterns of allow_repos, empty means all repos even the muted ones
+	Repos []string `json:"repos,omitempty"`
+	ChannelSelector
+}
+
+// Match returns why the stargazer is notable, empty if it's not.
+// The profile and the orgs are fetched only if needed, the stargazer is not notable if they can't be fetched.
+func (r *NotableRule) Match(login string, profile func() (Profile, error), orgs func() ([]string, error)) string {
+	if r == nil {
+		return ""
+	}
+	if containsLogin(r.Watchlist, login) {
+		return "on the watchlist"
+	}
+	if r.MinFollowers > 0 {
+		p, err := profile()
+		if err != nil {
+			log.Printf("get profile of %s: %v", login, err)
+		} else if p.Followers >= r.MinFollowers {
+			return fmt.Sprintf("%d followers", p.Followers)
+		}
+	}
+	if len(r.Orgs) > 0 {
+		l, err := orgs()
+		if err != nil {
+			log.Printf("get orgs of %s: %v", login, err)
+			return ""
+		}
+		for _, org := range l {
+			if containsLogin(r.Orgs, org) {
+				return "member of " + org
+			}
+		}
+	}
+	return ""
+}
+
+// AllowRepo reports whether the stargazers of the repo are alerted, regardless of the repo filters of the setting.
+func (r *NotableRule) AllowRepo(repo string) bool {
+	if r == nil {
+		return false
+	}
+	return len(r.Repos) == 0 || slices.ContainsFunc(
+		r.Repos, func(pattern string) bool {
+			return MatchRepo(pattern, repo)
+		},
+	)
+}
+
+func (r *NotableRule) validate(setting *Setting) error {
+	if r.MinFollowers < 0 {
+		return fmt.Errorf("invalid min_followers: %d", r.MinFollowers)
+	}
+	if slices.ContainsFunc(
+		slices.Concat(r.Orgs, r.Watchlist), func(s string) bool {
+			return strings.TrimSpace(s) == ""
+		},
+	) {
+		return fmt.Errorf("empty login in orgs or watchlist")
+	}
+	for _, pattern := range r.Repos {
+		if err := validateRepoPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return r.ChannelSelector.validate(setting)
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// The outbox is a Redis Stream of webhook events waiting to be notified, drained by a worker.
+// Failed jobs are scheduled to be retried later in a sorted set, and moved to the dead letters of
+// the account after too many attempts.
+
+const (
+	outboxGroup = "workers"
+	// 超过这个时间还未 ack 的消息，认为其 consumer 已经挂掉，由其他 consumer 接管
+	outboxClaimIdle = 5 * time.Minute
+)
+
+type OutboxJob struct {
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	Account    string          `json:"account"`
+	// Channels to retry, nil means all channels.
+	Retry      []string `json:"retry,omitempty"`
+	Attempts   int      `json:"attempts"`
+	LastError  string   `json:"last_error,omitempty"`
+	EnqueuedAt int64    `json:"enqueued_at"`
+	// The held star event of the settings with this debounce window in seconds, see Flap.
+	Debounce int `json:"debounce,omitempty"`
+	// The star event has been recorded to the history, so the retries don't record it again.
+	Recorded bool `json:"recorded,omitempty"`
+	// The logins whose settings are notified of the polled star, the ones that can read the repo, see Poll.
+	Watchers []string `json:"watchers,omitempty"`
+}
+
+type OutboxEntry struct {
+	ID  string
+	Job OutboxJob
+}
+
+// Enqueue appends the job to the outbox stream.
+func Enqueue(ctx context.Context, job OutboxJob) error {
+	v, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	redis := Redis()
+	cmd := redis.B().Xadd().Key(Key{"outbox", "stream"}.String()).Id("*").FieldValue().FieldValue("job", string(v)).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+func ensureOutboxGroup(ctx context.Context) error {
+	redis := Redis()
+	cmd := redis.B().XgroupCreate().Key(Key{"outbox", "stream"}.String()).Group(outboxGroup).Id("0").Mkstream().Build()
+	err := redis.Do(ctx, cmd).Error()
+	if rueidis.IsRedisBusyGroup(err) {
+		return nil
+	}
+	return err
+}
+
+func parseOutboxEntries(entries []rueidis.XRangeEntry) []OutboxEntry {
+	result := make([]OutboxEntry, 0, len(entries))
+	for _, entry := range entries {
+		var job OutboxJob
+		// malformed entries are returned with an empty job, so that they can be acked
+		_ = json.Unmarshal([]byte(entry.FieldValues["job"]), &job)
+		result = append(result, OutboxEntry{ID: entry.ID, Job: job})
+	}
+	return result
+}
+
+// ReadOutbox reads at most `count` jobs for the consumer, waiting up to `block` for new ones.
+// Jobs left unacked by crashed consumers are claimed first.
+func ReadOutbox(ctx context.Context, consumer string, count int64, block time.Duration) ([]OutboxEntry, error) {
+	err := ensureOutboxGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	redis := Redis()
+	key := Key{"outbox", "stream"}.String()
+
+	claim := redis.B().Xautoclaim().Key(key).Group(outboxGroup).Consumer(consumer).
+		MinIdleTime(strconv.FormatInt(outboxClaimIdle.Milliseconds(), 10)).Start("0-0").Count(count).Build()
+	arr, err := redis.Do(ctx, claim).ToArray()
+	if err != nil {
+		return nil, err
+	}
+	if len(arr) > 1 {
+		claimed, err := arr[1].AsXRange()
+		if err != nil {
+			return nil, err
+		}
+		if len(claimed) > 0 {
+			return parseOutboxEntries(claimed), nil
+		}
+	}
+
+	var cmd rueidis.Completed
+	if block > 0 {
+		cmd = redis.B().Xreadgroup().Group(outboxGroup, consumer).Count(count).Block(block.Milliseconds()).
+			Streams().Key(key).Id(">").Build()
+	} else {
+		cmd = redis.B().Xreadgroup().Group(outboxGroup, consumer).Count(count).Streams().Key(key).Id(">").Build()
+	}
+	streams, err := redis.Do(ctx, cmd).AsXRead()
+	if rueidis.IsRedisNil(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseOutboxEntries(streams[key]), nil
+}
+
+// AckOutbox removes the job from the outbox.
+func AckOutbox(ctx context.Context, id string) error {
+	redis := Redis()
+	key := Key{"outbox", "stream"}.String()
+	for _, resp := range redis.DoMulti(
+		ctx,
+		redis.B().Xack().Key(key).Group(outboxGroup).Id(id).Build(),
+		redis.B().Xdel().Key(key).Id(id).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleRetry puts the job back to the outbox at the given time.
+func ScheduleRetry(ctx context.Context, job OutboxJob, at time.Time) error {
+	v, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	redis := Redis()
+	cmd := redis.B().Zadd().Key(Key{"outbox", "retry"}.String()).ScoreMember().ScoreMember(float64(at.Unix()), string(v)).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// PromoteRetries moves the jobs due to retry back to the outbox stream.
+func PromoteRetries(ctx context.Context, now time.Time) (int, error) {
+	redis := Redis()
+	key := Key{"outbox", "retry"}.String()
+	cmd := redis.B().Zrangebyscore().Key(key).Min("-inf").Max(strconv.FormatInt(now.Unix(), 10)).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, member := range members {
+		// 多个 worker 同时搬运时，只有成功删除的那个负责重新入队
+		removed, err := redis.Do(ctx, redis.B().Zrem().Key(key).Member(member).Build()).AsInt64()
+		if err != nil {
+			return n, err
+		}
+		if removed == 0 {
+			continue
+		}
+		var job OutboxJob
+		err = json.Unmarshal([]byte(member), &job)
+		if err != nil {
+			continue
+		}
+		err = Enqueue(ctx, job)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// DeadLetterID identifies the dead letter of the job. The star events held for debounce share the delivery
+// with the live job, so they are told apart by their windows.
+func (j OutboxJob) DeadLetterID() string {
+	if j.Debounce == 0 {
+		return j.DeliveryID
+	}
+	return j.DeliveryID + ":debounce-" + strconv.Itoa(j.Debounce)
+}
+
+// DeadLetter keeps the job that failed too many times, so that it can be inspected and replayed later.
+func DeadLetter(ctx context.Context, job OutboxJob) error {
+	v, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	redis := Redis()
+	cmd := redis.B().Hset().Key(Key{"outbox", "dead", job.Account}.String()).FieldValue().
+		FieldValue(job.DeadLetterID(), string(v)).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+func GetDeadLetters(ctx context.Context, account string) ([]OutboxJob, error) {
+	redis := Redis()
+	cmd := redis.B().Hvals().Key(Key{"outbox", "dead", account}.String()).Build()
+	vals, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]OutboxJob, 0, len(vals))
+	for _, v := range vals {
+		var job OutboxJob
+		err = json.Unmarshal([]byte(v), &job)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RemoveDeadLetter removes the dead letter of the ID and returns it, ErrCacheMiss is returned if it doesn't exist.
+func RemoveDeadLetter(ctx context.Context, account, id string) (*OutboxJob, error) {
+	redis := Redis()
+	key := Key{"outbox", "dead", account}.String()
+	v, err := redis.Do(ctx, redis.B().Hget().Key(key).Field(id).Build()).AsBytes()
+	if rueidis.IsRedisNil(err) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job OutboxJob
+	err = json.Unmarshal(v, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := redis.Do(ctx, redis.B().Hdel().Key(key).Field(id).Build()).AsInt64()
+	if err != nil {
+		return nil, err
+	}
+	if removed == 0 {
+		// replayed by someone else
+		return nil, ErrCacheMiss
+	}
+	return &job, nil
+}
+
+// RemoveDeliveryDeadLetters removes the dead letters of all the jobs of the delivery.
+func RemoveDeliveryDeadLetters(ctx context.Context, account, deliveryID string) error {
+	redis := Redis()
+	key := Key{"outbox", "dead", account}.String()
+	ids, err := redis.Do(ctx, redis.B().Hkeys().Key(key).Build()).AsStrSlice()
+	if err != nil {
+		return err
+	}
+	ids = slices.DeleteFunc(
+		ids, func(id string) bool {
+			return id != deliveryID && !strings.HasPrefix(id, deliveryID+":")
+		},
+	)
+	if len(ids) == 0 {
+		return nil
+	}
+	return redis.Do(ctx, redis.B().Hdel().Key(key).Field(ids...).Build()).Error()
+}
+
+// ClaimTask returns true if the periodic task hasn't been run by anyone within the interval.
+func ClaimTask(ctx context.Context, name string, interval time.Duration) (bool, error) {
+	return SetNX(ctx, Key{"task", name}, time.Now().Unix(), interval)
+}
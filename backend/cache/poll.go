@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxWatchRepos is the most repos a setting can watch by polling
+	MaxWatchRepos = 20
+	// the states of the repos not watched anymore are dropped after this
+	pollStateExpire = 30 * 24 * time.Hour
+	// the access of the watchers to the private repos is checked again after this
+	pollAccessExpire = time.Hour
+)
+
+// PollState is what the poller knows about a watched repo.
+type PollState struct {
+	// ETag of the repo, the repo is fetched with `If-None-Match`
+	ETag  string `json:"etag,omitempty"`
+	Stars int    `json:"stars"`
+	// The latest star seen, the stars after it are new
+	LastStarredAt int64 `json:"last_starred_at"`
+}
+
+// GetPollState returns the state of the watched repo, the zero state if it's never polled.
+func GetPollState(ctx context.Context, repo string) (PollState, error) {
+	state, err := Get[PollState](ctx, Key{"poll", "state", repo})
+	if errors.Is(err, ErrCacheMiss) {
+		return PollState{}, nil
+	}
+	return state, err
+}
+
+func SavePollState(ctx context.Context, repo string, state PollState) error {
+	return Set(ctx, Key{"poll", "state", repo}, state, pollStateExpire)
+}
+
+// CanReadRepo returns whether the login can read the watched repo with its own token, checked by `check`
+// and cached for a while.
+func CanReadRepo(ctx context.Context, repo, login string, check func() (bool, error)) (bool, error) {
+	return GetOrCreate(ctx, Key{"poll", "access", repo, login}, pollAccessExpire, check)
+}
+
+// Watcher is a setting that watches repos by polling.
+type Watcher struct {
+	Account string
+	Login   string
+}
+
+func (w Watcher) member() string {
+	return w.Account + "/" + w.Login
+}
+
+// AddWatcher adds the setting to the ones polled for its watch_repos.
+func AddWatcher(ctx context.Context, w Watcher) error {
+	redis := Redis()
+	cmd := redis.B().Sadd().Key(Key{"poll", "watchers"}.String()).Member(w.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+func RemoveWatcher(ctx context.Context, w Watcher) error {
+	redis := Redis()
+	cmd := redis.B().Srem().Key(Key{"poll", "watchers"}.String()).Member(w.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// Watchers returns the settings that watch repos by polling.
+func Watchers(ctx context.Context) ([]Watcher, error) {
+	redis := Redis()
+	cmd := redis.B().Smembers().Key(Key{"poll", "watchers"}.String()).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	var watchers []Watcher
+	for _, member := range members {
+		account, login, ok := strings.Cut(member, "/")
+		if !ok {
+			continue
+		}
+		watchers = append(watchers, Watcher{Account: account, Login: login})
+	}
+	return watchers, nil
+}
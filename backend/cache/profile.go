@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+)
+
+const ProfileExpire = 24 * time.Hour
+
+// Profile is the GitHub profile of a stargazer.
+type Profile struct {
+	Login       string `json:"login"`
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Company     string `json:"company,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Blog        string `json:"blog,omitempty"`
+	Twitter     string `json:"twitter,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	HTMLURL     string `json:"html_url,omitempty"`
+	Followers   int    `json:"followers"`
+	PublicRepos int    `json:"public_repos"`
+	CreatedAt   int64  `json:"created_at"`
+}
+
+func (p *Profile) IsBot() bool {
+	return p.Type == "Bot"
+}
+
+func (p *Profile) IsOrganization() bool {
+	return p.Type == "Organization"
+}
+
+// AccountAge returns how long the account has existed.
+func (p *Profile) AccountAge(now time.Time) time.Duration {
+	return now.Sub(time.Unix(p.CreatedAt, 0))
+}
+
+func NewProfile(user *github.User) Profile {
+	return Profile{
+		Login:       user.GetLogin(),
+		Type:        user.GetType(),
+		Name:        user.GetName(),
+		Company:     user.GetCompany(),
+		Location:    user.GetLocation(),
+		Bio:         user.GetBio(),
+		Blog:        user.GetBlog(),
+		Twitter:     user.GetTwitterUsername(),
+		AvatarURL:   user.GetAvatarURL(),
+		HTMLURL:     user.GetHTMLURL(),
+		Followers:   user.GetFollowers(),
+		PublicRepos: user.GetPublicRepos(),
+		CreatedAt:   user.GetCreatedAt().Unix(),
+	}
+}
+
+// GetProfile returns the profile of the login, fetched with the installation token and cached for a day.
+func GetProfile(ctx context.Context, installationID int64, login string) (Profile, error) {
+	return GetOrCreate(
+		ctx, Key{"profile", login}, ProfileExpire, func() (Profile, error) {
+			token, err := GetInstallationToken(ctx, installationID)
+			if err != nil {
+				return Profile{}, err
+			}
+
+			client := github.NewTokenClient(ctx, token)
+			user, _, err := client.Users.Get(ctx, login)
+			if err != nil {
+				return Profile{}, err
+			}
+			return NewProfile(user), nil
+		},
+	)
+}
+
+// GetOrgs returns the orgs that the login is a public member of, cached for a day.
+func GetOrgs(ctx context.Context, installationID int64, login string) ([]string, error) {
+	return GetOrCreate(
+		ctx, Key{"orgs", login}, ProfileExpire, func() ([]string, error) {
+			token, err := GetInstallationToken(ctx, installationID)
+			if err != nil {
+				return nil, err
+			}
+
+			client := github.NewTokenClient(ctx, token)
+			opts := &github.ListOptions{PerPage: 100}
+			orgs := make([]string, 0)
+			for {
+				list, resp, err := client.Organizations.List(ctx, login, opts)
+				if err != nil {
+					return nil, err
+				}
+				for _, org := range list {
+					orgs = append(orgs, org.GetLogin())
+				}
+				if resp.NextPage == 0 {
+					break
+				}
+				opts.Page = resp.NextPage
+			}
+			return orgs, nil
+		},
+	)
+}
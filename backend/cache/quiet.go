@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// What to do with the notifications during quiet hours.
+const (
+	// QuietDefer delivers them as a summary when the quiet hours end
+	QuietDefer = "defer"
+	// QuietSilent sends them without a sound on the channels that support it, and defers the others
+	QuietSilent = "silent"
+)
+
+// QuietHours is a window of time in which notifications are held back.
+type QuietHours struct {
+	// Days of week the window starts on, 0 is Sunday. Empty means every day.
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	// "22:00"
+	Start string `json:"start"`
+	// "07:00", a time not after Start means the next day
+	End string `json:"end"`
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// window returns the quiet window starting on the day of `day`.
+func (q QuietHours) window(day time.Time) (time.Time, time.Time, bool) {
+	if len(q.Weekdays) > 0 && !slices.Contains(q.Weekdays, day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	from := midnight.Add(start)
+	to := midnight.Add(end)
+	if !to.After(from) {
+		to = midnight.AddDate(0, 0, 1).Add(end)
+	}
+	return from, to, true
+}
+
+func (s *Setting) validateQuietHours() error {
+	switch s.QuietMode {
+	case "", QuietDefer, QuietSilent:
+	default:
+		return fmt.Errorf("invalid quiet_mode: %s", s.QuietMode)
+	}
+	for i, q := range s.QuietHours {
+		if _, err := parseClock(q.Start); err != nil {
+			return fmt.Errorf("quiet hours #%d: %w", i+1, err)
+		}
+		if _, err := parseClock(q.End); err != nil {
+			return fmt.Errorf("quiet hours #%d: %w", i+1, err)
+		}
+		for _, d := range q.Weekdays {
+			if d < time.Sunday || d > time.Saturday {
+				return fmt.Errorf("quiet hours #%d: invalid weekday: %d", i+1, d)
+			}
+		}
+	}
+	return nil
+}
+
+// QuietUntil returns the end of the quiet hours `now` is in, and false if it is not in quiet hours.
+func (s *Setting) QuietUntil(now time.Time) (time.Time, bool) {
+	now = now.In(s.Location())
+	var until time.Time
+	for _, q := range s.QuietHours {
+		// a window started yesterday may last until today
+		for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+			from, to, ok := q.window(day)
+			if ok && !now.Before(from) && now.Before(to) && to.After(until) {
+				until = to
+			}
+		}
+	}
+	return until, !until.IsZero()
+}
+
+// IsSilent reports whether notifications in quiet hours are sent silently.
+func (s *Setting) IsSilent() bool {
+	return s.QuietMode == QuietSilent
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingQuietUntil(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("load timezone: %v", err)
+	}
+	// 2026-10-19 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai)
+	}
+	night := QuietHours{Start: "22:00", End: "07:00"}
+	lunch := QuietHours{Start: "12:00", End: "13:30"}
+	quiet := func(hours ...QuietHours) Setting {
+		return Setting{Timezone: "Asia/Shanghai", QuietHours: hours}
+	}
+
+	tests := []struct {
+		name    string
+		setting Setting
+		now     time.Time
+		until   time.Time
+		quiet   bool
+	}{
+		{"no quiet hours", Setting{}, at(19, 23, 0), time.Time{}, false},
+		{"same day", quiet(lunch), at(19, 12, 30), at(19, 13, 30), true},
+		{"same day end", quiet(lunch), at(19, 13, 30), time.Time{}, false},
+		{"before midnight", quiet(night), at(19, 23, 0), at(20, 7, 0), true},
+		{"after midnight", quiet(night), at(20, 6, 59), at(20, 7, 0), true},
+		{"start", quiet(night), at(19, 22, 0), at(20, 7, 0), true},
+		{"outside", quiet(night), at(19, 21, 59), time.Time{}, false},
+		{
+			"started on a listed weekday",
+			quiet(QuietHours{Weekdays: []time.Weekday{time.Friday}, Start: "23:00", End: "09:00"}),
+			at(24, 8, 0),
+			at(24, 9, 0),
+			true,
+		},
+		{
+			"not started on a listed weekday",
+			quiet(QuietHours{Weekdays: []time.Weekday{time.Friday}, Start: "23:00", End: "09:00"}),
+			at(19, 8, 0),
+			time.Time{},
+			false,
+		},
+		{
+			"overlapping windows end at the later one",
+			quiet(night, QuietHours{Start: "06:00", End: "08:00"}),
+			at(20, 6, 30),
+			at(20, 8, 0),
+			true,
+		},
+		{
+			"timezone of the setting",
+			quiet(night),
+			time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC),
+			at(20, 7, 0),
+			true,
+		},
+		{
+			"utc by default",
+			Setting{QuietHours: []QuietHours{night}},
+			time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC),
+			time.Time{},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				until, quiet := tt.setting.QuietUntil(tt.now)
+				if quiet != tt.quiet || !until.Equal(tt.until) {
+					t.Errorf("QuietUntil() = %s, %v, want %s, %v", until, quiet, tt.until, tt.quiet)
+				}
+			},
+		)
+	}
+}
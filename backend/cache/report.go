@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The settings with a weekly report are kept in a sorted set scored by the time of their next report.
+
+// ReportSchedule sends a weekly star report built from the star history.
+type ReportSchedule struct {
+	// 0 is Sunday
+	Weekday time.Weekday `json:"weekday"`
+	Hour    int          `json:"hour"`
+	// IANA timezone, defaults to the timezone of the setting
+	Timezone string `json:"timezone,omitempty"`
+	ChannelSelector
+}
+
+func (r *ReportSchedule) validate(setting *Setting) error {
+	if r.Weekday < time.Sunday || r.Weekday > time.Saturday {
+		return fmt.Errorf("invalid weekday: %d", r.Weekday)
+	}
+	if r.Hour < 0 || r.Hour > 23 {
+		return fmt.Errorf("invalid hour: %d", r.Hour)
+	}
+	if r.Timezone != "" {
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", r.Timezone)
+		}
+	}
+	return r.ChannelSelector.validate(setting)
+}
+
+// NextReport returns the time of the next weekly report after now, false if the setting has no report.
+func (s *Setting) NextReport(now time.Time) (time.Time, bool) {
+	r := s.Report
+	if r == nil {
+		return time.Time{}, false
+	}
+	loc := s.Location()
+	if r.Timezone != "" {
+		if l, err := time.LoadLocation(r.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	local := now.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), r.Hour, 0, 0, 0, loc)
+	next = next.AddDate(0, 0, (int(r.Weekday)-int(next.Weekday())+7)%7)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next, true
+}
+
+// ReportTarget identifies the setting of a login in an account that has a scheduled report.
+type ReportTarget struct {
+	Account string
+	Login   string
+}
+
+func (t ReportTarget) member() string {
+	return t.Account + "/" + t.Login
+}
+
+// ScheduleReport schedules the report of the setting at `at`, replacing the previous schedule.
+func ScheduleReport(ctx context.Context, t ReportTarget, at time.Time) error {
+	redis := Redis()
+	cmd := redis.B().Zadd().Key(Key{"report", "pending"}.String()).ScoreMember().
+		ScoreMember(float64(at.Unix()), t.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+func UnscheduleReport(ctx context.Context, t ReportTarget) error {
+	redis := Redis()
+	cmd := redis.B().Zrem().Key(Key{"report", "pending"}.String()).Member(t.member()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
+
+// SetReportRetry keeps the channels the report failed to be sent to, so that the retry sends only to them.
+func SetReportRetry(ctx context.Context, t ReportTarget, channels []string) error {
+	return Set(ctx, Key{"report", "retry", t.Account, t.Login}, channels, 7*24*time.Hour)
+}
+
+// GetReportRetry returns the channels to retry the report, nil if it's not a retry.
+func GetReportRetry(ctx context.Context, t ReportTarget) ([]string, error) {
+	channels, err := Get[[]string](ctx, Key{"report", "retry", t.Account, t.Login})
+	if errors.Is(err, ErrCacheMiss) {
+		return nil, nil
+	}
+	return channels, err
+}
+
+func ClearReportRetry(ctx context.Context, t ReportTarget) error {
+	return Delete(ctx, Key{"report", "retry", t.Account, t.Login})
+}
+
+// PopDueReports returns the settings whose reports are due, and removes them from the pending set.
+func PopDueReports(ctx context.Context, now time.Time) ([]ReportTarget, error) {
+	redis := Redis()
+	key := Key{"report", "pending"}.String()
+	cmd := redis.B().Zrangebyscore().Key(key).Min("-inf").Max(strconv.FormatInt(now.Unix(), 10)).Build()
+	members, err := redis.Do(ctx, cmd).AsStrSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []ReportTarget
+	for _, member := range members {
+		removed, err := redis.Do(ctx, redis.B().Zrem().Key(key).Member(member).Build()).AsInt64()
+		if err != nil {
+			return targets, err
+		}
+		// claimed by another worker
+		if removed == 0 {
+			continue
+		}
+		account, login, ok := strings.Cut(member, "/")
+		if !ok {
+			continue
+		}
+		targets = append(targets, ReportTarget{Account: account, Login: login})
+	}
+	return targets, nil
+}
+
+// ScheduleSetting keeps the report schedule and the poll watchers in line with the setting.
+func ScheduleSetting(ctx context.Context, account, login string, setting *Setting, now time.Time) error {
+	t, w := ReportTarget{Account: account, Login: login}, Watcher{Account: account, Login: login}
+	var errs []error
+	// a changed setting starts over with all its channels
+	errs = append(errs, ClearReportRetry(ctx, t))
+	if next, ok := setting.NextReport(now); ok {
+		errs = append(errs, ScheduleReport(ctx, t, next))
+	} else {
+		errs = append(errs, UnscheduleReport(ctx, t))
+	}
+	if len(setting.WatchRepos) > 0 {
+		errs = append(errs, AddWatcher(ctx, w))
+	} else {
+		errs = append(errs, RemoveWatcher(ctx, w))
+	}
+	return errors.Join(errs...)
+}
+
+// UnscheduleSetting stops the reports and the polling of the setting, used when it's deleted or archived.
+func UnscheduleSetting(ctx context.Context, account, login string) error {
+	return errors.Join(
+		UnscheduleReport(ctx, ReportTarget{Account: account, Login: login}),
+		ClearReportRetry(ctx, ReportTarget{Account: account, Login: login}),
+		RemoveWatcher(ctx, Watcher{Account: account, Login: login}),
+	)
+}
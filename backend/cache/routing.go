@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Event kinds that can be routed.
+const (
+	RouteCreated     = "created"
+	RouteDeleted     = "deleted"
+	RouteMilestone   = "milestone"
+	RouteNotable     = "notable"
+	RouteSpike       = "spike"
+	RouteSuspicion   = "suspicion"
+	RouteFork        = "fork"
+	RouteRelease     = "release"
+	RouteSponsorship = "sponsorship"
+	RouteDiscussion  = "discussion"
+)
+
+// the kinds of notifications about stars
+var starRoutes = []string{RouteCreated, RouteDeleted, RouteMilestone, RouteNotable, RouteSpike, RouteSuspicion}
+
+// OptInEvents are the events other than star that a setting can opt in with `events`.
+var OptInEvents = []string{RouteFork, RouteRelease, RouteSponsorship, RouteDiscussion}
+
+// RoutingRule sends the matching events to a subset of the channels.
+// Rules are evaluated in order and the first matching one wins, events matching no rule are not sent.
+type RoutingRule struct {
+	// Repo patterns like AllowRepos, empty means all repos
+	Repos []string `json:"repos,omitempty"`
+	// Event kinds, empty means `created` and `deleted`
+	Actions   []string         `json:"actions,omitempty"`
+	Stargazer *StargazerFilter `json:"stargazer,omitempty"`
+	// IDs of the notify settings
+	Channels ChannelRefs `json:"channels"`
+}
+
+func (r *RoutingRule) matches(kind, repo, login string, profile func() (Profile, error)) bool {
+	if len(r.Actions) == 0 {
+		if kind != RouteCreated && kind != RouteDeleted {
+			return false
+		}
+	} else if !slices.Contains(r.Actions, kind) {
+		return false
+	}
+	if len(r.Repos) > 0 && !slices.ContainsFunc(
+		r.Repos, func(pattern string) bool {
+			return MatchRepo(pattern, repo)
+		},
+	) {
+		return false
+	}
+	if r.Stargazer != nil && !r.Stargazer.Match(login, profile) {
+		return false
+	}
+	return true
+}
+
+func (r *RoutingRule) validate(setting *Setting) error {
+	for _, action := range r.Actions {
+		if !slices.Contains(starRoutes, action) && !slices.Contains(OptInEvents, action) {
+			return fmt.Errorf("invalid action: %s", action)
+		}
+	}
+	for _, pattern := range r.Repos {
+		if err := validateRepoPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if r.Stargazer != nil {
+		if err := r.Stargazer.validate(); err != nil {
+			return err
+		}
+	}
+	return validateChannels(r.Channels, setting)
+}
+
+// ChannelRefs point to the notify settings by their IDs, which stay the same when the notify settings are reordered.
+// The indexes of the notify settings are accepted too, and turned into the IDs when the setting is saved.
+type ChannelRefs []string
+
+func (r *ChannelRefs) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == nil {
+		*r = nil
+		return nil
+	}
+	refs := make(ChannelRefs, 0, len(raw))
+	for _, item := range raw {
+		var index int
+		if err := json.Unmarshal(item, &index); err == nil {
+			refs = append(refs, strconv.Itoa(index))
+			continue
+		}
+		var id string
+		if err := json.Unmarshal(item, &id); err != nil {
+			return fmt.Errorf("invalid channel: %s", item)
+		}
+		refs = append(refs, id)
+	}
+	*r = refs
+	return nil
+}
+
+// ChannelSelector picks the notify settings to receive the alerts or the reports of a rule.
+type ChannelSelector struct {
+	// IDs of the notify settings, empty means all
+	Channels ChannelRefs `json:"channels,omitempty"`
+}
+
+func (c *ChannelSelector) validate(setting *Setting) error {
+	return validateChannels(c.Channels, setting)
+}
+
+func validateChannels(refs ChannelRefs, setting *Setting) error {
+	for _, ref := range refs {
+		if setting.channelRef(ref) < 0 {
+			return fmt.Errorf("invalid channel: %s", ref)
+		}
+	}
+	return nil
+}
+
+// Route returns the indexes of the notify settings to receive the event, nil means all of them.
+func (s *Setting) Route(kind, repo, login string, profile func() (Profile, error)) []int {
+	if len(s.Routes) == 0 {
+		if selector := s.alertChannels(kind); selector != nil && len(selector.Channels) > 0 {
+			return s.ResolveChannels(selector.Channels)
+		}
+		return nil
+	}
+	for _, rule := range s.Routes {
+		if rule.matches(kind, repo, login, profile) {
+			return s.ResolveChannels(rule.Channels)
+		}
+	}
+	return []int{}
+}
+
+// alertChannels returns the channel selector of the alert rule of the kind, nil if there is none.
+func (s *Setting) alertChannels(kind string) *ChannelSelector {
+	switch {
+	case kind == RouteMilestone && s.Milestones != nil:
+		return &s.Milestones.ChannelSelector
+	case kind == RouteNotable && s.Notable != nil:
+		return &s.Notable.ChannelSelector
+	case kind == RouteSpike && s.Spike != nil:
+		return &s.Spike.ChannelSelector
+	case kind == RouteSuspicion && s.Suspicion != nil:
+		return &s.Suspicion.ChannelSelector
+	}
+	return nil
+}
+
+// channelRefs returns all the refs to the notify settings in the setting.
+func (s *Setting) channelRefs() []*ChannelRefs {
+	var refs []*ChannelRefs
+	for _, selector := range []*ChannelSelector{
+		s.alertChannels(RouteMilestone),
+		s.alertChannels(RouteNotable),
+		s.alertChannels(RouteSpike),
+		s.alertChannels(RouteSuspicion),
+	} {
+		if selector != nil {
+			refs = append(refs, &selector.Channels)
+		}
+	}
+	if s.Report != nil {
+		refs = append(refs, &s.Report.Channels)
+	}
+	for i := range s.Routes {
+		refs = append(refs, &s.Routes[i].Channels)
+	}
+	return refs
+}
+
+// channelRef returns the index of the notify setting the ref points to, by its ID, or by its index
+// for the refs not turned into IDs yet. -1 if it points to none.
+func (s *Setting) channelRef(ref string) int {
+	for i, ns := range s.NotifySettings {
+		if ns[ChannelIDKey] == ref {
+			return i
+		}
+	}
+	// the IDs are never numbers, see assignChannelIDs
+	if i, err := strconv.Atoi(ref); err == nil && i >= 0 && i < len(s.NotifySettings) {
+		return i
+	}
+	return -1
+}
+
+// ResolveChannels returns the indexes of the notify settings the refs point to, the removed ones are left out.
+func (s *Setting) ResolveChannels(refs ChannelRefs) []int {
+	indexes := make([]int, 0, len(refs))
+	for _, ref := range refs {
+		if i := s.channelRef(ref); i >= 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// normalizeChannelRefs turns the refs by index into the IDs of the notify settings, and drops the dangling ones.
+func (s *Setting) normalizeChannelRefs() {
+	for _, refs := range s.channelRefs() {
+		if *refs == nil {
+			continue
+		}
+		normalized := make(ChannelRefs, 0, len(*refs))
+		for _, i := range s.ResolveChannels(*refs) {
+			normalized = append(normalized, s.NotifySettings[i][ChannelIDKey])
+		}
+		*refs = normalized
+	}
+}
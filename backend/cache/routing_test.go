@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSettingRoute(t *testing.T) {
+	channels := []map[string]string{
+		{ChannelIDKey: "tg"},
+		{ChannelIDKey: "discord"},
+		{ChannelIDKey: "bark"},
+	}
+	profile := func(p Profile) func() (Profile, error) {
+		return func() (Profile, error) { return p, nil }
+	}
+	noProfile := func() (Profile, error) { return Profile{}, errors.New("no profile") }
+	routes := []RoutingRule{
+		{Repos: []string{"owner/big"}, Channels: ChannelRefs{"bark"}},
+		{
+			Actions:   []string{RouteCreated},
+			Stargazer: &StargazerFilter{MinFollowers: 100},
+			Channels:  ChannelRefs{"tg", "discord"},
+		},
+		{Actions: []string{RouteMilestone, RouteSpike}, Channels: ChannelRefs{"discord"}},
+		{Actions: []string{RouteCreated, RouteDeleted}, Channels: ChannelRefs{"tg"}},
+	}
+
+	tests := []struct {
+		name    string
+		setting Setting
+		kind    string
+		repo    string
+		profile func() (Profile, error)
+		want    []int
+	}{
+		{"no routes", Setting{NotifySettings: channels}, RouteCreated, "owner/repo", noProfile, nil},
+		{
+			"alert channels without routes",
+			Setting{NotifySettings: channels, Spike: &SpikeRule{ChannelSelector: ChannelSelector{Channels: ChannelRefs{"bark"}}}},
+			RouteSpike,
+			"owner/repo",
+			noProfile,
+			[]int{2},
+		},
+		{
+			"alert channels of another kind",
+			Setting{NotifySettings: channels, Spike: &SpikeRule{ChannelSelector: ChannelSelector{Channels: ChannelRefs{"bark"}}}},
+			RouteMilestone,
+			"owner/repo",
+			noProfile,
+			nil,
+		},
+		{"repo rule", Setting{NotifySettings: channels, Routes: routes}, RouteDeleted, "owner/big", noProfile, []int{2}},
+		{
+			"stargazer rule",
+			Setting{NotifySettings: channels, Routes: routes},
+			RouteCreated,
+			"owner/repo",
+			profile(Profile{Followers: 1000}),
+			[]int{0, 1},
+		},
+		{
+			"stargazer rule not matched",
+			Setting{NotifySettings: channels, Routes: routes},
+			RouteCreated,
+			"owner/repo",
+			profile(Profile{Followers: 10}),
+			[]int{0},
+		},
+		{
+			"profile failed",
+			Setting{NotifySettings: channels, Routes: routes},
+			RouteCreated,
+			"owner/repo",
+			noProfile,
+			[]int{0, 1},
+		},
+		{"action rule", Setting{NotifySettings: channels, Routes: routes}, RouteSpike, "owner/repo", noProfile, []int{1}},
+		{"no rule matched", Setting{NotifySettings: channels, Routes: routes}, RouteNotable, "owner/repo", noProfile, []int{}},
+		{
+			"default actions",
+			Setting{NotifySettings: channels, Routes: []RoutingRule{{Channels: ChannelRefs{"bark"}}}},
+			RouteMilestone,
+			"owner/repo",
+			noProfile,
+			[]int{},
+		},
+		{
+			"refs by index",
+			Setting{NotifySettings: channels, Routes: []RoutingRule{{Channels: ChannelRefs{"2", "0"}}}},
+			RouteCreated,
+			"owner/repo",
+			noProfile,
+			[]int{2, 0},
+		},
+		{
+			"removed channel",
+			Setting{NotifySettings: channels, Routes: []RoutingRule{{Channels: ChannelRefs{"slack", "tg", "5"}}}},
+			RouteCreated,
+			"owner/repo",
+			noProfile,
+			[]int{0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				got := tt.setting.Route(tt.kind, tt.repo, "someone", tt.profile)
+				if (got == nil) != (tt.want == nil) || fmt.Sprint(got) != fmt.Sprint(tt.want) {
+					t.Errorf("Route() = %#v, want %#v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -3,34 +3,325 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/rueidis"
+
+	"github.com/j178/github_stargazer/backend/condition"
+	"github.com/j178/github_stargazer/backend/utils"
 )
 
 type Setting struct {
-	NotifySettings []map[string]string `json:"notify_settings"`
-	AllowRepos     []string            `json:"allow_repos"`
-	MuteRepos      []string            `json:"mute_repos"`
-	MuteLostStars  bool                `json:"mute_lost_stars"`
+	NotifySettings  []map[string]string `json:"notify_settings"`
+	AllowRepos      []string            `json:"allow_repos"`
+	MuteRepos       []string            `json:"mute_repos"`
+	MuteLostStars   bool                `json:"mute_lost_stars"`
+	ExcludeForks    bool                `json:"exclude_forks,omitempty"`
+	ExcludeArchived bool                `json:"exclude_archived,omitempty"`
+	ExcludePrivate  bool                `json:"exclude_private,omitempty"`
+	// IANA timezone of the quiet hours, and the default timezone of the digests
+	Timezone        string           `json:"timezone,omitempty"`
+	QuietHours      []QuietHours     `json:"quiet_hours,omitempty"`
+	QuietMode       string           `json:"quiet_mode,omitempty"`
+	Milestones      *MilestoneRule   `json:"milestones,omitempty"`
+	StargazerFilter *StargazerFilter `json:"stargazer_filter,omitempty"`
+	Notable         *NotableRule     `json:"notable,omitempty"`
+	Report          *ReportSchedule  `json:"report,omitempty"`
+	Spike           *SpikeRule       `json:"spike,omitempty"`
+	Suspicion       *SuspicionRule   `json:"suspicion,omitempty"`
+	Routes          []RoutingRule    `json:"routes,omitempty"`
+	// Repos where the app can't be installed, their stars are polled with the OAuth token of the login
+	WatchRepos []string `json:"watch_repos,omitempty"`
+	// Events other than star to be notified, see OptInEvents
+	Events []string `json:"events,omitempty"`
+	// notify the channels when the app is uninstalled from the account
+	NotifyUninstall bool `json:"notify_uninstall,omitempty"`
+	// introduce the stargazer with the GitHub profile in the star notifications
+	EnrichProfile bool `json:"enrich_profile,omitempty"`
+	// serve the star badges of the allowed public repos, see /api/badge
+	PublicBadges bool `json:"public_badges,omitempty"`
+	// secret of the feeds of the account, generated by the server, see /api/feed
+	FeedToken string `json:"feed_token,omitempty"`
+	// Seconds to hold a star, it's dropped with the unstar within the window. Restars within a day are ignored too.
+	Debounce int `json:"debounce,omitempty"`
+}
+
+// ChannelIDKey is the key of the stable ID of a notify setting, so that the failed channels and digests
+// still find it after the notify settings are reordered.
+const ChannelIDKey = "id"
+
+// assignChannelIDs gives a new ID to the notify settings without one, or with a duplicated one,
+// and points the refs to the notify settings by the IDs. An ID is never a number, to not be taken for an index.
+func (s *Setting) assignChannelIDs() error {
+	seen := make(map[string]bool)
+	for _, ns := range s.NotifySettings {
+		if ns == nil {
+			continue
+		}
+		if id := ns[ChannelIDKey]; id != "" && !seen[id] && !isNumber(id) {
+			seen[id] = true
+			continue
+		}
+		var id string
+		for id == "" || seen[id] || isNumber(id) {
+			var err error
+			id, err = utils.GenerateRandomString(8)
+			if err != nil {
+				return err
+			}
+		}
+		ns[ChannelIDKey] = id
+		seen[id] = true
+	}
+	s.normalizeChannelRefs()
+	return nil
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// ChannelIndex returns the index of the notify setting with the ID, -1 if it's gone.
+// The notify settings saved before they have IDs are identified by their indexes.
+func (s *Setting) ChannelIndex(id string) int {
+	for i, ns := range s.NotifySettings {
+		if ns[ChannelIDKey] == id {
+			return i
+		}
+	}
+	if i, err := strconv.Atoi(id); err == nil && i >= 0 && i < len(s.NotifySettings) &&
+		s.NotifySettings[i][ChannelIDKey] == "" {
+		return i
+	}
+	return -1
+}
+
+// DebounceWindow returns the debounce window of the setting, 0 if disabled.
+func (s *Setting) DebounceWindow() time.Duration {
+	return time.Duration(s.Debounce) * time.Second
+}
+
+// IsWatchRepo reports whether the repo is polled for the setting.
+func (s *Setting) IsWatchRepo(repo string) bool {
+	return slices.Contains(s.WatchRepos, repo)
+}
+
+// WantsEvent reports whether the setting has opted in the event.
+func (s *Setting) WantsEvent(kind string) bool {
+	return slices.Contains(s.Events, kind)
+}
+
+// Location returns the timezone of the setting, UTC if not set or invalid.
+func (s *Setting) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Validate checks the fields that can't be checked by decoding.
+func (s *Setting) Validate() error {
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", s.Timezone)
+		}
+	}
+	for _, pattern := range slices.Concat(s.AllowRepos, s.MuteRepos) {
+		if err := validateRepoPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if len(s.WatchRepos) > MaxWatchRepos {
+		return fmt.Errorf("too many watch_repos, at most %d", MaxWatchRepos)
+	}
+	for _, repo := range s.WatchRepos {
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" || strings.ContainsAny(name, "/*?[") {
+			return fmt.Errorf("invalid watch repo: %s", repo)
+		}
+	}
+	if err := s.validateQuietHours(); err != nil {
+		return err
+	}
+	if s.StargazerFilter != nil {
+		if err := s.StargazerFilter.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Milestones != nil {
+		if err := s.Milestones.validate(s); err != nil {
+			return err
+		}
+	}
+	if s.Notable != nil {
+		if err := s.Notable.validate(s); err != nil {
+			return fmt.Errorf("notable: %w", err)
+		}
+	}
+	if s.Report != nil {
+		if err := s.Report.validate(s); err != nil {
+			return fmt.Errorf("report: %w", err)
+		}
+	}
+	if s.Spike != nil {
+		if err := s.Spike.validate(s); err != nil {
+			return fmt.Errorf("spike: %w", err)
+		}
+	}
+	if s.Suspicion != nil {
+		if err := s.Suspicion.validate(s); err != nil {
+			return fmt.Errorf("suspicion: %w", err)
+		}
+	}
+	if s.Debounce < 0 || s.DebounceWindow() > MaxDebounce {
+		return fmt.Errorf("debounce must be between 0 and %d seconds", int(MaxDebounce/time.Second))
+	}
+	for _, event := range s.Events {
+		if !slices.Contains(OptInEvents, event) {
+			return fmt.Errorf("invalid event: %s", event)
+		}
+	}
+	for i, rule := range s.Routes {
+		if err := rule.validate(s); err != nil {
+			return fmt.Errorf("routes #%d: %w", i+1, err)
+		}
+	}
+	for i, ns := range s.NotifySettings {
+		if _, err := ParseChannelDelivery(ns, time.UTC); err != nil {
+			return fmt.Errorf("notify settings #%d: %w", i+1, err)
+		}
+		if src := ns["filter"]; src != "" {
+			if _, err := condition.Compile(src); err != nil {
+				return fmt.Errorf("notify settings #%d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
 }
 
-func (s *Setting) IsAllowRepo(fullName string) bool {
-	for _, repo := range s.MuteRepos {
-		if repo == fullName {
+func (s *Setting) IsAllowRepo(repo RepoInfo) bool {
+	// watched explicitly
+	if s.IsWatchRepo(repo.FullName) {
+		return true
+	}
+	if (s.ExcludeForks && repo.Fork) || (s.ExcludeArchived && repo.Archived) || (s.ExcludePrivate && repo.Private) {
+		return false
+	}
+	for _, pattern := range s.MuteRepos {
+		if MatchRepo(pattern, repo.FullName) {
 			return false
 		}
 	}
 	if len(s.AllowRepos) == 0 {
 		return true
 	}
-	for _, repo := range s.AllowRepos {
-		if repo == fullName {
+	for _, pattern := range s.AllowRepos {
+		if MatchRepo(pattern, repo.FullName) {
 			return true
 		}
 	}
 	return false
 }
 
+// IsAllowRepoName is IsAllowRepo for the repos known by their names only, like the ones in the star history.
+// The repo is looked up for its attributes if the setting excludes forks, archived or private repos.
+func (s *Setting) IsAllowRepoName(ctx context.Context, repo string) (bool, error) {
+	info := RepoInfo{FullName: repo}
+	if !s.IsWatchRepo(repo) && (s.ExcludeForks || s.ExcludeArchived || s.ExcludePrivate) {
+		stars, err := GetRepoStars(ctx, repo)
+		if err != nil {
+			return false, err
+		}
+		info = stars.RepoInfo
+	}
+	return s.IsAllowRepo(info), nil
+}
+
+// Delivery modes of a channel, set by the `delivery` key of a notify setting.
+const (
+	DeliveryImmediate = "immediate"
+	DeliveryHourly    = "hourly"
+	DeliveryDaily     = "daily"
+	DeliveryWeekly    = "weekly"
+)
+
+const defaultDigestHour = 9
+
+// ChannelDelivery describes when a channel receives the notifications.
+type ChannelDelivery struct {
+	Mode     string
+	Location *time.Location
+	// Hour of the day to send daily and weekly digests
+	Hour int
+}
+
+func (d ChannelDelivery) IsDigest() bool {
+	return d.Mode != DeliveryImmediate
+}
+
+// ParseChannelDelivery reads the `delivery`, `timezone` and `digest_hour` keys of a notify setting,
+// `loc` is used if `timezone` is not set.
+func ParseChannelDelivery(setting map[string]string, loc *time.Location) (ChannelDelivery, error) {
+	d := ChannelDelivery{Mode: setting["delivery"], Location: loc, Hour: defaultDigestHour}
+	switch d.Mode {
+	case "":
+		d.Mode = DeliveryImmediate
+	case DeliveryImmediate, DeliveryHourly, DeliveryDaily, DeliveryWeekly:
+	default:
+		return d, fmt.Errorf("invalid delivery: %s", d.Mode)
+	}
+
+	if tz := setting["timezone"]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return d, fmt.Errorf("invalid timezone: %s", tz)
+		}
+		d.Location = loc
+	}
+	if hour := setting["digest_hour"]; hour != "" {
+		h, err := strconv.Atoi(hour)
+		if err != nil || h < 0 || h > 23 {
+			return d, fmt.Errorf("invalid digest_hour: %s", hour)
+		}
+		d.Hour = h
+	}
+	return d, nil
+}
+
+// NextDigest returns the time to send the digest collected from now on.
+func (d ChannelDelivery) NextDigest(now time.Time) time.Time {
+	now = now.In(d.Location)
+	switch d.Mode {
+	case DeliveryHourly:
+		return now.Truncate(time.Hour).Add(time.Hour)
+	case DeliveryDaily:
+		next := time.Date(now.Year(), now.Month(), now.Day(), d.Hour, 0, 0, 0, d.Location)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	case DeliveryWeekly:
+		// every Monday
+		days := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+		next := time.Date(now.Year(), now.Month(), now.Day()+days, d.Hour, 0, 0, 0, d.Location)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	default:
+		return now
+	}
+}
+
 // settings 是两级结构，第一层是 org (如果是个人账号，org 为 login 本身)，第二层是 login
 
 func GetSettings(ctx context.Context, account string, login string) (*Setting, error) {
@@ -74,6 +365,9 @@ func GetAllSettings(ctx context.Context, account string) (map[string]*Setting, e
 }
 
 func SaveSettings(ctx context.Context, account, login string, setting Setting) error {
+	if err := setting.assignChannelIDs(); err != nil {
+		return err
+	}
 	redis := Redis()
 	val, err := json.Marshal(setting)
 	if err != nil {
@@ -90,3 +384,55 @@ func DeleteSettings(ctx context.Context, account, login string) error {
 	err := redis.Do(ctx, cmd).Error()
 	return err
 }
+
+// ArchivedSettingsExpire is how long the settings of an uninstalled account are kept.
+const ArchivedSettingsExpire = 30 * 24 * time.Hour
+
+// ArchiveSettings moves all settings of the account aside, so that they can be restored if the app is installed again.
+func ArchiveSettings(ctx context.Context, account string) error {
+	redis := Redis()
+	key := Key{"settings", account}.String()
+	archived := Key{"settings_archived", account}.String()
+
+	n, err := redis.Do(ctx, redis.B().Exists().Key(key).Build()).AsInt64()
+	if err != nil || n == 0 {
+		return err
+	}
+	for _, resp := range redis.DoMulti(
+		ctx,
+		redis.B().Rename().Key(key).Newkey(archived).Build(),
+		redis.B().Expire().Key(archived).Seconds(int64(ArchivedSettingsExpire/time.Second)).Build(),
+	) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreSettings restores the archived settings of the account, unless the account has settings already.
+// Returns whether the settings are restored.
+func RestoreSettings(ctx context.Context, account string) (bool, error) {
+	redis := Redis()
+	key := Key{"settings", account}.String()
+	archived := Key{"settings_archived", account}.String()
+
+	n, err := redis.Do(ctx, redis.B().Exists().Key(archived).Build()).AsInt64()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	cmd := redis.B().Renamenx().Key(archived).Newkey(key).Build()
+	ok, err := redis.Do(ctx, cmd).AsBool()
+	if err != nil || !ok {
+		return false, err
+	}
+	err = redis.Do(ctx, redis.B().Persist().Key(key).Build()).Error()
+	return true, err
+}
+
+// DeleteAllSettings deletes the settings of all logins of the account.
+func DeleteAllSettings(ctx context.Context, account string) error {
+	redis := Redis()
+	cmd := redis.B().Del().Key(Key{"settings", account}.String()).Build()
+	return redis.Do(ctx, cmd).Error()
+}
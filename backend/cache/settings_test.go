@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannelDeliveryNextDigest(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("load timezone: %v", err)
+	}
+	// 2026-10-19 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai)
+	}
+
+	tests := []struct {
+		name    string
+		setting map[string]string
+		now     time.Time
+		want    time.Time
+	}{
+		{"immediate", map[string]string{}, at(19, 10, 15), at(19, 10, 15)},
+		{"hourly", map[string]string{"delivery": "hourly"}, at(19, 10, 15), at(19, 11, 0)},
+		{"hourly on the hour", map[string]string{"delivery": "hourly"}, at(19, 10, 0), at(19, 11, 0)},
+		{"daily", map[string]string{"delivery": "daily"}, at(19, 8, 0), at(19, 9, 0)},
+		{"daily passed", map[string]string{"delivery": "daily"}, at(19, 9, 0), at(20, 9, 0)},
+		{"daily hour", map[string]string{"delivery": "daily", "digest_hour": "21"}, at(19, 22, 0), at(20, 21, 0)},
+		{"weekly", map[string]string{"delivery": "weekly"}, at(22, 10, 0), at(26, 9, 0)},
+		{"weekly on monday", map[string]string{"delivery": "weekly"}, at(19, 8, 0), at(19, 9, 0)},
+		{"weekly passed on monday", map[string]string{"delivery": "weekly"}, at(19, 9, 30), at(26, 9, 0)},
+		{
+			"timezone of the channel",
+			map[string]string{"delivery": "daily", "timezone": "UTC"},
+			at(19, 18, 0),
+			time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				d, err := ParseChannelDelivery(tt.setting, shanghai)
+				if err != nil {
+					t.Fatalf("ParseChannelDelivery: %v", err)
+				}
+				if got := d.NextDigest(tt.now); !got.Equal(tt.want) {
+					t.Errorf("NextDigest() = %s, want %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestParseChannelDeliveryInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting map[string]string
+	}{
+		{"delivery", map[string]string{"delivery": "monthly"}},
+		{"timezone", map[string]string{"delivery": "daily", "timezone": "Mars/Olympus"}},
+		{"digest hour", map[string]string{"delivery": "daily", "digest_hour": "24"}},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				if _, err := ParseChannelDelivery(tt.setting, time.UTC); err == nil {
+					t.Errorf("ParseChannelDelivery(%v) = nil error", tt.setting)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// Stars of each repo are counted in 5 minute buckets for the recent window, and in daily buckets for the baseline.
+
+const (
+	rateBucket = 5 * time.Minute
+	// MaxSpikeWindow is the max window of a spike rule
+	MaxSpikeWindow = 6 * time.Hour
+	baselineDays   = 7
+)
+
+const (
+	defaultSpikeMultiplier = 5
+	defaultSpikeMinStars   = 10
+	defaultSpikeWindow     = 60
+	defaultSpikeCooldown   = 6 * 60
+)
+
+// SpikeRule alerts when the star rate of a repo exceeds a multiple of its baseline.
+type SpikeRule struct {
+	// Times of the baseline rate, default 5
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Minimum stars in the window to alert, default 10
+	MinStars int `json:"min_stars,omitempty"`
+	// Minutes of the window, rounded up to 5 minutes, default 60
+	Window int `json:"window,omitempty"`
+	// Minutes before the next alert of the same repo, default 360
+	Cooldown int `json:"cooldown,omitempty"`
+	ChannelSelector
+}
+
+func (r *SpikeRule) GetMultiplier() float64 {
+	if r.Multiplier <= 0 {
+		return defaultSpikeMultiplier
+	}
+	return r.Multiplier
+}
+
+func (r *SpikeRule) GetMinStars() int {
+	if r.MinStars <= 0 {
+		return defaultSpikeMinStars
+	}
+	return r.MinStars
+}
+
+func (r *SpikeRule) GetWindow() time.Duration {
+	minutes := r.Window
+	if minutes <= 0 {
+		minutes = defaultSpikeWindow
+	}
+	return (time.Duration(minutes)*time.Minute + rateBucket - 1).Truncate(rateBucket)
+}
+
+func (r *SpikeRule) GetCooldown() time.Duration {
+	if r.Cooldown <= 0 {
+		return defaultSpikeCooldown * time.Minute
+	}
+	return time.Duration(r.Cooldown) * time.Minute
+}
+
+// Matches reports whether the stars in the window is a spike over the baseline stars of the same length.
+func (r *SpikeRule) Matches(stars int, baseline float64) bool {
+	if r == nil || stars < r.GetMinStars() {
+		return false
+	}
+	return float64(stars) >= r.GetMultiplier()*baseline
+}
+
+func (r *SpikeRule) validate(setting *Setting) error {
+	if r.Multiplier < 0 {
+		return fmt.Errorf("invalid multiplier: %v", r.Multiplier)
+	}
+	if r.MinStars < 0 || r.Cooldown < 0 {
+		return fmt.Errorf("min_stars and cooldown must not be negative")
+	}
+	if r.Window < 0 || r.GetWindow() > MaxSpikeWindow {
+		return fmt.Errorf("window must be between 0 and %d minutes", int(MaxSpikeWindow/time.Minute))
+	}
+	return r.ChannelSelector.validate(setting)
+}
+
+func rateKey(repo string, bucket time.Time) Key {
+	return Key{"rate", repo, strconv.FormatInt(bucket.Unix(), 10)}
+}
+
+func dailyRateKey(repo string, day time.Time) Key {
+	return Key{"rate_daily", repo, day.Format(time.DateOnly)}
+}
+
+// CountStar counts a star of the repo at `at`.
+func CountStar(ctx context.Context, repo string, at time.Time) error {
+	at = at.UTC()
+	if _, err := Incr(ctx, rateKey(repo, at.Truncate(rateBucket)), MaxSpikeWindow+rateBucket); err != nil {
+		return err
+	}
+	_, err := Incr(ctx, dailyRateKey(repo, at.Truncate(24*time.Hour)), (baselineDays+1)*24*time.Hour)
+	return err
+}
+
+func sumCounters(ctx context.Context, keys []Key) (int, error) {
+	redis := Redis()
+	cmd := redis.B().Mget().Key(keysString(keys)...).Build()
+	vals, err := redis.Do(ctx, cmd).ToArray()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, v := range vals {
+		n, err := v.AsInt64()
+		if rueidis.IsRedisNil(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += int(n)
+	}
+	return total, nil
+}
+
+func keysString(keys []Key) []string {
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = k.String()
+	}
+	return s
+}
+
+// StarRate returns the stars of the repo in the window until now,
+// and the average stars in a window of the same length over the previous days.
+func StarRate(ctx context.Context, repo string, now time.Time, window time.Duration) (int, float64, error) {
+	now = now.UTC()
+	var recent []Key
+	for t := now.Truncate(rateBucket); t.After(now.Add(-window)); t = t.Add(-rateBucket) {
+		recent = append(recent, rateKey(repo, t))
+	}
+	stars, err := sumCounters(ctx, recent)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var days []Key
+	today := now.Truncate(24 * time.Hour)
+	for i := 1; i <= baselineDays; i++ {
+		days = append(days, dailyRateKey(repo, today.AddDate(0, 0, -i)))
+	}
+	total, err := sumCounters(ctx, days)
+	if err != nil {
+		return 0, 0, err
+	}
+	baseline := float64(total) / (baselineDays * 24 * float64(time.Hour)) * float64(window)
+	return stars, baseline, nil
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// StargazerFilter filters the events by the profile of the stargazer.
+type StargazerFilter struct {
+	MinFollowers int `json:"min_followers,omitempty"`
+	// Minimum age of the account in days
+	MinAccountAge        int  `json:"min_account_age,omitempty"`
+	ExcludeBots          bool `json:"exclude_bots,omitempty"`
+	ExcludeOrganizations bool `json:"exclude_organizations,omitempty"`
+	// Logins that always pass the filter
+	AllowLogins []string `json:"allow_logins,omitempty"`
+	// Logins that never pass the filter
+	DenyLogins []string `json:"deny_logins,omitempty"`
+}
+
+func containsLogin(logins []string, login string) bool {
+	return slices.ContainsFunc(
+		logins, func(l string) bool {
+			return strings.EqualFold(l, login)
+		},
+	)
+}
+
+// NeedsProfile reports whether the filter can't be decided by the login alone.
+func (f *StargazerFilter) NeedsProfile() bool {
+	return f.MinFollowers > 0 || f.MinAccountAge > 0 || f.ExcludeBots || f.ExcludeOrganizations
+}
+
+// AllowLogin decides by the login only, returns false for `decided` if the profile is needed.
+func (f *StargazerFilter) AllowLogin(login string) (allowed bool, decided bool) {
+	if containsLogin(f.DenyLogins, login) {
+		return false, true
+	}
+	if containsLogin(f.AllowLogins, login) {
+		return true, true
+	}
+	if !f.NeedsProfile() {
+		return true, true
+	}
+	return false, false
+}
+
+// Allow reports whether the stargazer passes the filter.
+func (f *StargazerFilter) Allow(p *Profile, now time.Time) bool {
+	if allowed, decided := f.AllowLogin(p.Login); decided {
+		return allowed
+	}
+	if f.ExcludeBots && p.IsBot() {
+		return false
+	}
+	if f.ExcludeOrganizations && p.IsOrganization() {
+		return false
+	}
+	if p.Followers < f.MinFollowers {
+		return false
+	}
+	if f.MinAccountAge > 0 && p.AccountAge(now) < time.Duration(f.MinAccountAge)*24*time.Hour {
+		return false
+	}
+	return true
+}
+
+// Match is like Allow, but the profile is fetched only if needed.
+// The stargazer passes if the profile can't be fetched, missing a star is worse than a noisy one.
+func (f *StargazerFilter) Match(login string, profile func() (Profile, error)) bool {
+	if allowed, decided := f.AllowLogin(login); decided {
+		return allowed
+	}
+
+	p, err := profile()
+	if err != nil {
+		log.Printf("get profile of %s: %v", login, err)
+		return true
+	}
+	return f.Allow(&p, time.Now())
+}
+
+func (f *StargazerFilter) validate() error {
+	if f.MinFollowers < 0 {
+		return fmt.Errorf("invalid min_followers: %d", f.MinFollowers)
+	}
+	if f.MinAccountAge < 0 {
+		return fmt.Errorf("invalid min_account_age: %d", f.MinAccountAge)
+	}
+	return nil
+}
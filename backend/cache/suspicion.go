@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultSuspicionScore         = 0.5
+	defaultSuspicionMinStargazers = 10
+	// SuspicionDays is how many recent days of stargazers are checked by the alerts
+	SuspicionDays = 7
+	// a repo is checked at most once in this interval
+	suspicionCheckInterval = time.Hour
+	suspicionCooldown      = 24 * time.Hour
+)
+
+// SuspicionRule alerts when the recent stargazers of a repo look like a fake star campaign.
+type SuspicionRule struct {
+	// Minimum score of the repo to alert, from 0 to 1, default 0.5
+	MinScore float64 `json:"min_score,omitempty"`
+	// Minimum stargazers analyzed to alert, default 10
+	MinStargazers int `json:"min_stargazers,omitempty"`
+	ChannelSelector
+}
+
+func (r *SuspicionRule) GetMinScore() float64 {
+	if r.MinScore <= 0 {
+		return defaultSuspicionScore
+	}
+	return r.MinScore
+}
+
+func (r *SuspicionRule) GetMinStargazers() int {
+	if r.MinStargazers <= 0 {
+		return defaultSuspicionMinStargazers
+	}
+	return r.MinStargazers
+}
+
+// GetCooldown returns the least interval between two alerts of a repo.
+func (r *SuspicionRule) GetCooldown() time.Duration {
+	return suspicionCooldown
+}
+
+// Matches reports whether the score of the repo with the analyzed stargazers is worth an alert.
+func (r *SuspicionRule) Matches(score float64, analyzed int) bool {
+	return r != nil && analyzed >= r.GetMinStargazers() && score >= r.GetMinScore()
+}
+
+func (r *SuspicionRule) validate(setting *Setting) error {
+	if r.MinScore < 0 || r.MinScore > 1 {
+		return fmt.Errorf("min_score must be between 0 and 1")
+	}
+	if r.MinStargazers < 0 {
+		return fmt.Errorf("invalid min_stargazers: %d", r.MinStargazers)
+	}
+	return r.ChannelSelector.validate(setting)
+}
+
+// ClaimSuspicionCheck returns false if the repo has been checked recently, the profile lookups are expensive.
+func ClaimSuspicionCheck(ctx context.Context, repo string) (bool, error) {
+	return SetNX(ctx, Key{"suspicion", "check", repo}, time.Now().Unix(), suspicionCheckInterval)
+}
@@ -2,11 +2,14 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/google/go-github/v84/github"
 	"golang.org/x/oauth2"
 	oauthGitHub "golang.org/x/oauth2/github"
 
@@ -53,6 +56,10 @@ func SaveOAuthToken(ctx context.Context, login string, token *oauth2.Token) erro
 	return Set(ctx, Key{string(OAuthTokenType), login}, token, FOREVER)
 }
 
+func DeleteOAuthToken(ctx context.Context, login string) error {
+	return Delete(ctx, Key{string(OAuthTokenType), login})
+}
+
 type InstallationToken struct {
 	Token          string `json:"token"`
 	ExpiresAt      int64  `json:"expires_at"`
@@ -107,3 +114,41 @@ func createInstallationToken(ctx context.Context, installationID int64) (string,
 	}
 	return token, nil
 }
+
+func DeleteInstallationToken(ctx context.Context, installationID int64) error {
+	return Delete(ctx, Key{string(InstallationTokenType), strconv.FormatInt(installationID, 10)})
+}
+
+// GetRepoInstallationID returns the installation of the app on the repo, cached for a day.
+func GetRepoInstallationID(ctx context.Context, repo string) (int64, error) {
+	return GetOrCreate(
+		ctx, Key{"repo_installation", repo}, 24*time.Hour, func() (int64, error) {
+			tr, err := ghinstallation.NewAppsTransport(http.DefaultTransport, config.AppID, config.AppPrivateKey)
+			if err != nil {
+				return 0, err
+			}
+			client := github.NewClient(&http.Client{Transport: tr})
+			owner, name, _ := strings.Cut(repo, "/")
+			installation, _, err := client.Apps.FindRepositoryInstallation(ctx, owner, name)
+			if err != nil {
+				return 0, err
+			}
+			return installation.GetID(), nil
+		},
+	)
+}
+
+// ForgetRepoInstallation drops the cached installation of the repos, and the badge lookups made with it,
+// called when the repos are added to or removed from an installation.
+func ForgetRepoInstallation(ctx context.Context, repos ...string) error {
+	var errs []error
+	for _, repo := range repos {
+		errs = append(
+			errs,
+			Delete(ctx, Key{"repo_installation", repo}),
+			Delete(ctx, Key{"repo_stars", repo}),
+			Delete(ctx, Key{"repo_stars", "failed", repo}),
+		)
+	}
+	return errors.Join(errs...)
+}
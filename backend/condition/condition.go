@@ -0,0 +1,141 @@
+package condition
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Filter expressions of notify settings, written in https://expr-lang.org, e.g.
+//
+//	repo.stars >= 500 && sender.followers > 1000 && action == "created"
+//
+// Expressions can only read the Env, they have no access to anything else.
+
+const (
+	maxNodes    = 200
+	maxPrograms = 1024
+)
+
+type Repo struct {
+	Name     string   `expr:"name"`
+	FullName string   `expr:"full_name"`
+	Owner    string   `expr:"owner"`
+	Stars    int      `expr:"stars"`
+	Forks    int      `expr:"forks"`
+	Language string   `expr:"language"`
+	Topics   []string `expr:"topics"`
+	Fork     bool     `expr:"fork"`
+	Private  bool     `expr:"private"`
+	Archived bool     `expr:"archived"`
+}
+
+type Sender struct {
+	Login          string `expr:"login"`
+	Type           string `expr:"type"`
+	Name           string `expr:"name"`
+	Company        string `expr:"company"`
+	Location       string `expr:"location"`
+	Followers      int    `expr:"followers"`
+	PublicRepos    int    `expr:"public_repos"`
+	AccountAgeDays int    `expr:"account_age_days"`
+}
+
+// Env is what an expression can see.
+type Env struct {
+	// "created", "deleted", "milestone", "fork", "release", "sponsorship" or "discussion"
+	Action string `expr:"action"`
+	Repo   Repo   `expr:"repo"`
+	Sender Sender `expr:"sender"`
+}
+
+// fields of the sender that are in the webhook payload, the others need the profile
+var payloadSenderFields = map[string]bool{"login": true, "type": true}
+
+type Program struct {
+	program     *vm.Program
+	usesProfile bool
+}
+
+// UsesProfile reports whether the expression needs the profile of the sender.
+func (p *Program) UsesProfile() bool {
+	return p.usesProfile
+}
+
+// Eval runs the expression against the env.
+func (p *Program) Eval(env Env) (bool, error) {
+	out, err := expr.Run(p.program, env)
+	if err != nil {
+		return false, err
+	}
+	return out.(bool), nil
+}
+
+// profileVisitor finds out whether the expression may read the profile of the sender.
+// Only the direct reads of the payload fields, like `sender.login`, don't need it.
+// Any other use of `sender`, e.g. `let s = sender; s.followers`, loads the profile.
+type profileVisitor struct {
+	senders      int
+	payloadReads int
+}
+
+func (v *profileVisitor) usesProfile() bool {
+	return v.senders > v.payloadReads
+}
+
+func (v *profileVisitor) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.IdentifierNode:
+		if n.Value == "sender" {
+			v.senders++
+		}
+	case *ast.MemberNode:
+		ident, ok := n.Node.(*ast.IdentifierNode)
+		if !ok || ident.Value != "sender" {
+			return
+		}
+		if prop, ok := n.Property.(*ast.StringNode); ok && payloadSenderFields[prop.Value] {
+			v.payloadReads++
+		}
+	}
+}
+
+var (
+	mu       sync.Mutex
+	programs = make(map[string]*Program)
+)
+
+// Compile compiles the expression, the error contains the position of the problem.
+// Compiled programs are cached by their source.
+func Compile(src string) (*Program, error) {
+	mu.Lock()
+	p, ok := programs[src]
+	mu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	visitor := &profileVisitor{}
+	program, err := expr.Compile(
+		src,
+		expr.Env(Env{}),
+		expr.AsBool(),
+		expr.MaxNodes(maxNodes),
+		expr.Patch(visitor),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	p = &Program{program: program, usesProfile: visitor.usesProfile()}
+
+	mu.Lock()
+	if len(programs) >= maxPrograms {
+		programs = make(map[string]*Program)
+	}
+	programs[src] = p
+	mu.Unlock()
+	return p, nil
+}
@@ -0,0 +1,78 @@
+package condition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		src         string
+		usesProfile bool
+		// a part of the error, the position of the problem if there is one, empty if it compiles
+		err string
+	}{
+		{src: `action == "created"`},
+		{src: `repo.stars >= 500 && "go" in repo.topics`},
+		{src: `sender.login == "octocat"`},
+		{src: `sender.type != "Bot" && sender["login"] startsWith "a"`},
+		{src: `sender.followers > 1000`, usesProfile: true},
+		{src: `sender.login == "octocat" || sender.account_age_days < 7`, usesProfile: true},
+		{src: `let s = sender; s.login == "octocat"`, usesProfile: true},
+		{src: `sender["company"] contains "GitHub"`, usesProfile: true},
+		{src: `repo.stars >=`, err: "(1:13)"},
+		{src: `repo.star > 1`, err: "(1:6)"},
+		{src: `action == "created" &&` + "\n" + `secrets.token != ""`, err: "(2:1)"},
+		{src: `repo.stars`, err: "expected bool"},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.src, func(t *testing.T) {
+				p, err := Compile(tt.src)
+				if tt.err != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Fatalf("Compile() error = %v, want %q", err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				if p.UsesProfile() != tt.usesProfile {
+					t.Errorf("UsesProfile() = %v, want %v", p.UsesProfile(), tt.usesProfile)
+				}
+			},
+		)
+	}
+}
+
+func TestProgramEval(t *testing.T) {
+	env := Env{
+		Action: "created",
+		Repo:   Repo{FullName: "owner/repo", Stars: 600, Topics: []string{"go"}},
+		Sender: Sender{Login: "octocat", Followers: 2000},
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`repo.stars >= 500 && sender.followers > 1000 && action == "created"`, true},
+		{`action == "deleted"`, false},
+		{`"rust" in repo.topics`, false},
+		{`let s = sender; s.login == "octocat"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.src, func(t *testing.T) {
+				p, err := Compile(tt.src)
+				if err != nil {
+					t.Fatalf("Compile() error = %v", err)
+				}
+				got, err := p.Eval(env)
+				if err != nil || got != tt.want {
+					t.Errorf("Eval() = %v, %v, want %v", got, err, tt.want)
+				}
+			},
+		)
+	}
+}
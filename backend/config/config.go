@@ -44,6 +44,9 @@ var (
 	DiscordAppID        string
 	DiscordPublicKey    ed25519.PublicKey
 	DiscordBotToken     string
+	CronSecret          string
+	// what to do with the settings when the app is uninstalled: archive or delete
+	UninstallSettings string
 )
 
 func loadEnv() {
@@ -75,6 +78,8 @@ func loadEnv() {
 	}
 
 	DiscordBotToken = env("DISCORD_BOT_TOKEN")
+	CronSecret = envOrDefault("CRON_SECRET", "")
+	UninstallSettings = envOrDefault("UNINSTALL_SETTINGS", "archive")
 }
 
 var Load = sync.OnceFunc(loadEnv)
@@ -1,13 +1,22 @@
 package notify
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 
 	"github.com/nikoksr/notify/service/bark"
 )
 
 type barkService struct {
 	*bark.Service
+	key    string
+	server string
 }
 
 func (s *barkService) Name() string {
@@ -25,5 +34,45 @@ func (s *barkService) Configure(settings map[string]string) error {
 	}
 
 	s.Service = bark.NewWithServers(key, server)
+	s.key = key
+	s.server = server
+	return nil
+}
+
+// SendSilent sends the message with the `passive` level, which doesn't light up the screen.
+// The bark library doesn't support levels, so we make the request ourselves.
+func (s *barkService) SendSilent(ctx context.Context, subject, message string) error {
+	body, err := json.Marshal(
+		map[string]string{
+			"device_key": s.key,
+			"title":      subject,
+			"body":       message,
+			"level":      "passive",
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	server := s.server
+	if !strings.HasPrefix(server, "http://") && !strings.HasPrefix(server, "https://") {
+		server = "https://" + server
+	}
+	pushURL := strings.TrimSuffix(server, "/") + "/push"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("bark send: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		result, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bark returned status code %d: %s", resp.StatusCode, result)
+	}
 	return nil
 }
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Constructing a notifier may be expensive, e.g. a custom telegram bot makes a `getMe` request,
+// so configured notifiers are cached by the hash of their settings.
+
+const maxCachedNotifiers = 256
+
+// httpClient is shared by notifiers to reuse connections.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type notifierCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cacheEntry struct {
+	key      string
+	notifier Notifier
+}
+
+var notifiers = &notifierCache{
+	entries: make(map[string]*list.Element),
+	lru:     list.New(),
+}
+
+func settingHash(setting map[string]string) string {
+	// map keys are sorted by json.Marshal
+	b, _ := json.Marshal(setting)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *notifierCache) get(key string) (Notifier, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).notifier, true
+}
+
+func (c *notifierCache) add(key string, notifier Notifier) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).notifier = notifier
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, notifier: notifier})
+	for c.lru.Len() > maxCachedNotifiers {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *notifierCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Invalidate drops the cached notifiers of the settings, they will be constructed again on next use.
+func Invalidate(settings []map[string]string) {
+	for _, setting := range settings {
+		notifiers.remove(settingHash(setting))
+	}
+}
@@ -60,6 +60,7 @@ func (d *discordBotService) Configure(settings map[string]string) error {
 		if err != nil {
 			return err
 		}
+		bot.Client = httpClient
 	}
 	d.bot = bot
 
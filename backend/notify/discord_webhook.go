@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -26,7 +27,14 @@ type discordWebhookService struct {
 	color        int64
 }
 
-// TODO: add discord bot support
+// webhooks don't need a token, so a single session is shared by all webhooks
+var webhookSession = sync.OnceValue(
+	func() *discordgo.Session {
+		session, _ := discordgo.New("")
+		session.Client = httpClient
+		return session
+	},
+)
 
 func (s *discordWebhookService) Name() string {
 	return "discord_webhook"
@@ -69,9 +77,8 @@ func (s *discordWebhookService) Send(ctx context.Context, title, message string)
 		},
 	}
 
-	session, _ := discordgo.New("")
 	// https://discord.com/developers/docs/resources/webhook#execute-webhook
-	_, err := session.WebhookExecute(s.webhookID, s.webhookToken, false, &params, discordgo.WithContext(ctx))
+	_, err := webhookSession().WebhookExecute(s.webhookID, s.webhookToken, false, &params, discordgo.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("discord webhook: %w", err)
 	}
@@ -2,6 +2,7 @@ package notify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/sourcegraph/conc/pool"
@@ -15,6 +16,32 @@ type Notifier interface {
 	Send(context.Context, string, string) error
 }
 
+// SilentNotifier is implemented by the notifiers that can deliver a message without a sound.
+type SilentNotifier interface {
+	SendSilent(context.Context, string, string) error
+}
+
+// SupportsSilent reports whether the service of the setting can deliver messages silently.
+func SupportsSilent(setting map[string]string) bool {
+	switch setting["service"] {
+	case "telegram", "bark":
+		return true
+	}
+	return false
+}
+
+type templateDataKey struct{}
+
+// WithTemplateData attaches extra data of the message to the context, it's exposed to the body templates of webhooks.
+func WithTemplateData(ctx context.Context, data map[string]any) context.Context {
+	return context.WithValue(ctx, templateDataKey{}, data)
+}
+
+func templateData(ctx context.Context) map[string]any {
+	data, _ := ctx.Value(templateDataKey{}).(map[string]any)
+	return data
+}
+
 type Notify struct {
 	notifiers []Notifier
 }
@@ -24,52 +51,86 @@ func (n *Notify) AddNotifier(notifier Notifier) {
 }
 
 func (n *Notify) Send(ctx context.Context, subject, message string) error {
-	wg := pool.New().WithContext(ctx).WithMaxGoroutines(10)
-	for _, notifier := range n.notifiers {
+	err := errors.Join(n.SendAll(ctx, subject, message)...)
+	if err != nil {
+		return fmt.Errorf("send notify: %w", err)
+	}
+
+	return nil
+}
+
+// SendAll sends the message with every notifier, and returns their errors in the order they were added.
+func (n *Notify) SendAll(ctx context.Context, subject, message string) []error {
+	return n.sendAll(ctx, subject, message, false)
+}
+
+// SendAllSilent is like SendAll, but delivers the message silently with the notifiers that support it.
+func (n *Notify) SendAllSilent(ctx context.Context, subject, message string) []error {
+	return n.sendAll(ctx, subject, message, true)
+}
+
+func (n *Notify) sendAll(ctx context.Context, subject, message string, silent bool) []error {
+	errs := make([]error, len(n.notifiers))
+	wg := pool.New().WithMaxGoroutines(10)
+	for i, notifier := range n.notifiers {
 		if notifier == nil {
 			continue
 		}
 
-		notifier := notifier
 		wg.Go(
-			func(ctx context.Context) error {
-				return notifier.Send(ctx, subject, message)
+			func() {
+				if s, ok := notifier.(SilentNotifier); ok && silent {
+					errs[i] = s.SendSilent(ctx, subject, message)
+					return
+				}
+				errs[i] = notifier.Send(ctx, subject, message)
 			},
 		)
 	}
+	wg.Wait()
 
-	err := wg.Wait()
-	if err != nil {
-		return fmt.Errorf("send notify: %w", err)
+	return errs
+}
+
+func newNotifier(setting map[string]string) (Notifier, error) {
+	serviceName := setting["service"]
+	var service Notifier
+	// TODO: add slack, mastodon, etc.
+	switch serviceName {
+	case "bark":
+		service = &barkService{}
+	case "telegram":
+		service = &telegramService{}
+	case "discord_webhook":
+		service = &discordWebhookService{}
+	case "discord_bot":
+		service = &discordBotService{}
+	case "webhook":
+		service = &webhookService{}
+	default:
+		return nil, fmt.Errorf("unknown service: %s", serviceName)
 	}
 
-	return nil
+	err := service.Configure(setting)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", service.Name(), err)
+	}
+	return service, nil
 }
 
+// GetNotifier returns a Notify with the configured notifiers, reusing the cached ones.
 func GetNotifier(settings []map[string]string) (*Notify, error) {
 	notify := &Notify{}
 	for _, setting := range settings {
-		serviceName := setting["service"]
-		var service Notifier
-		// TODO: add slack, mastodon, etc.
-		switch serviceName {
-		case "bark":
-			service = &barkService{}
-		case "telegram":
-			service = &telegramService{}
-		case "discord_webhook":
-			service = &discordWebhookService{}
-		case "discord_bot":
-			service = &discordBotService{}
-		case "webhook":
-			service = &webhookService{}
-		default:
-			return nil, fmt.Errorf("unknown service: %s", serviceName)
-		}
-
-		err := service.Configure(setting)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", service.Name(), err)
+		key := settingHash(setting)
+		service, ok := notifiers.get(key)
+		if !ok {
+			var err error
+			service, err = newNotifier(setting)
+			if err != nil {
+				return nil, err
+			}
+			notifiers.add(key, service)
 		}
 		notify.AddNotifier(service)
 	}
@@ -47,7 +47,7 @@ func (t *telegramService) Configure(settings map[string]string) error {
 	if token == "" || token == "default" {
 		tg = DefaultTelegramBot()
 	} else {
-		tg, err = tgbotapi.NewBotAPI(token)
+		tg, err = tgbotapi.NewBotAPIWithClient(token, tgbotapi.APIEndpoint, httpClient)
 		if err != nil {
 			return err
 		}
@@ -60,11 +60,20 @@ func (t *telegramService) Configure(settings map[string]string) error {
 }
 
 func (t *telegramService) Send(ctx context.Context, subject, message string) error {
+	return t.send(ctx, subject, message, false)
+}
+
+func (t *telegramService) SendSilent(ctx context.Context, subject, message string) error {
+	return t.send(ctx, subject, message, true)
+}
+
+func (t *telegramService) send(ctx context.Context, subject, message string, silent bool) error {
 	fullMessage := subject + "\n" + message // Treating subject as message title
 
 	msg := tgbotapi.NewMessage(t.chatID, fullMessage)
 	msg.ParseMode = "MarkdownV2"
 	msg.DisableWebPagePreview = true
+	msg.DisableNotification = silent
 
 	select {
 	case <-ctx.Done():
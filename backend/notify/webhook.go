@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"strings"
 	"text/template"
@@ -81,9 +82,10 @@ func (s *webhookService) Send(ctx context.Context, title, message string) error
 	req := s.req.Clone(ctx)
 
 	if s.body != nil {
-		var bodyData struct{ Title, Message string }
-		bodyData.Title = title
-		bodyData.Message = message
+		bodyData := map[string]any{}
+		maps.Copy(bodyData, templateData(ctx))
+		bodyData["Title"] = title
+		bodyData["Message"] = message
 
 		var bodyStr bytes.Buffer
 		err := s.body.Execute(&bodyStr, bodyData)
@@ -94,9 +96,11 @@ func (s *webhookService) Send(ctx context.Context, title, message string) error
 		req.Body = io.NopCloser(&bodyStr)
 	}
 
-	_, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("webhook send: %w", err)
 	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
 	return nil
 }
@@ -0,0 +1,132 @@
+package badge
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+const (
+	growthPeriod   = 7 * 24 * time.Hour
+	maxLabelLength = 64
+)
+
+// allowBadge reports whether any member of the account has opted in the badges of the repo.
+func allowBadge(settings map[string]*cache.Setting, repo cache.RepoInfo) bool {
+	if repo.Private {
+		return false
+	}
+	return lo.SomeBy(
+		lo.Values(settings), func(s *cache.Setting) bool {
+			return s.PublicBadges && s.IsAllowRepo(repo)
+		},
+	)
+}
+
+// growth returns the net stars of the repo in the recent week from the star history.
+func growth(c *gin.Context, repo string, now time.Time) (int, error) {
+	records, err := cache.GetStarHistory(c, repo, now.Add(-growthPeriod), now)
+	if err != nil {
+		return 0, err
+	}
+	net := 0
+	for _, r := range records {
+		switch r.Action {
+		case "created":
+			net++
+		case "deleted":
+			net--
+		}
+	}
+	return net, nil
+}
+
+func message(stars, net int, showGrowth bool) string {
+	msg := "★ " + utils.FormatCompact(stars)
+	if showGrowth && net != 0 {
+		msg += fmt.Sprintf(" (%+d this week)", net)
+	}
+	return msg
+}
+
+// Badge renders the star badge of a public repo, e.g. `★ 4.2k (+120 this week)`.
+// Query: label, color, label_color, style (flat, flat-square, plastic), growth=false to hide the weekly growth.
+func Badge(c *gin.Context) {
+	owner := c.Param("owner")
+	name, ok := strings.CutSuffix(c.Param("repo"), ".svg")
+	if !ok {
+		routes.Abort(c, http.StatusNotFound, nil, "badge must end with .svg")
+		return
+	}
+	repo := owner + "/" + name
+
+	label := c.DefaultQuery("label", "stars")
+	if len(label) > maxLabelLength {
+		routes.Abort(c, http.StatusBadRequest, nil, "label too long")
+		return
+	}
+	color, err := parseColor(c.DefaultQuery("color", "blue"))
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid color")
+		return
+	}
+	labelColor, err := parseColor(c.DefaultQuery("label_color", "grey"))
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid label_color")
+		return
+	}
+	style := c.DefaultQuery("style", "flat")
+	if !slices.Contains(styles, style) {
+		routes.Abort(c, http.StatusBadRequest, nil, "invalid style")
+		return
+	}
+	showGrowth, err := strconv.ParseBool(c.DefaultQuery("growth", "true"))
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid growth")
+		return
+	}
+
+	settings, err := cache.GetAllSettings(c, owner)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get settings")
+		return
+	}
+	// don't tell apart the repos not installed from the ones not opted in
+	if !lo.SomeBy(lo.Values(settings), func(s *cache.Setting) bool { return s.PublicBadges }) {
+		routes.Abort(c, http.StatusNotFound, nil, "badge not found")
+		return
+	}
+	info, err := cache.GetRepoStars(c, repo)
+	if err != nil || !allowBadge(settings, info.RepoInfo) {
+		routes.Abort(c, http.StatusNotFound, err, "badge not found")
+		return
+	}
+	net, err := growth(c, repo, time.Now())
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get star history")
+		return
+	}
+
+	body := render(label, message(info.Stars, net, showGrowth), labelColor, color, style)
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cache.BadgeExpire.Seconds())))
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", body)
+}
@@ -0,0 +1,137 @@
+package badge
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var namedColors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellow":      "#dfb317",
+	"yellowgreen": "#a4a61d",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+	"blue":        "#007ec6",
+	"grey":        "#555",
+	"gray":        "#555",
+	"lightgrey":   "#9f9f9f",
+	"lightgray":   "#9f9f9f",
+}
+
+var hexColor = regexp.MustCompile(`^[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$`)
+
+var styles = []string{"flat", "flat-square", "plastic"}
+
+// parseColor accepts the shields color names and hex colors without `#`.
+func parseColor(color string) (string, error) {
+	if c, ok := namedColors[strings.ToLower(color)]; ok {
+		return c, nil
+	}
+	if hexColor.MatchString(color) {
+		return "#" + color, nil
+	}
+	return "", fmt.Errorf("invalid color: %s", color)
+}
+
+// textWidth roughly measures the text in 11px Verdana, close enough to size the badge.
+func textWidth(text string) int {
+	var w float64
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune("ijlI.,:;!|'", r):
+			w += 3.5
+		case strings.ContainsRune(" frt()[]-", r):
+			w += 4.5
+		case strings.ContainsRune("mwMW%", r):
+			w += 10.5
+		case unicode.IsUpper(r):
+			w += 7.5
+		case unicode.IsDigit(r):
+			w += 7
+		case r > unicode.MaxLatin1:
+			w += 11
+		default:
+			w += 6.5
+		}
+	}
+	return int(math.Ceil(w))
+}
+
+type badgeData struct {
+	Label, Message string
+	LabelColor     string
+	Color          string
+	Width          int
+	Height         int
+	LabelWidth     int
+	MessageWidth   int
+	LabelX         float64
+	MessageX       float64
+	TextY          int
+	Radius         int
+	Gradient       bool
+	Plastic        bool
+}
+
+var badgeTemplate = template.Must(
+	template.New("badge").Parse(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}" role="img" aria-label="{{.Label}}: {{.Message}}">` +
+			`<title>{{.Label}}: {{.Message}}</title>` +
+			`{{if .Gradient}}<linearGradient id="s" x2="0" y2="100%">` +
+			`{{if .Plastic}}<stop offset="0" stop-color="#fff" stop-opacity=".7"/><stop offset=".1" stop-color="#aaa" stop-opacity=".1"/><stop offset=".9" stop-opacity=".3"/><stop offset="1" stop-opacity=".5"/>` +
+			`{{else}}<stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/>{{end}}` +
+			`</linearGradient>{{end}}` +
+			`<clipPath id="r"><rect width="{{.Width}}" height="{{.Height}}" rx="{{.Radius}}" fill="#fff"/></clipPath>` +
+			`<g clip-path="url(#r)">` +
+			`<rect width="{{.LabelWidth}}" height="{{.Height}}" fill="{{.LabelColor}}"/>` +
+			`<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="{{.Height}}" fill="{{.Color}}"/>` +
+			`{{if .Gradient}}<rect width="{{.Width}}" height="{{.Height}}" fill="url(#s)"/>{{end}}` +
+			`</g>` +
+			`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` +
+			`{{if .Gradient}}<text x="{{.LabelX}}" y="{{.TextY}}" fill="#010101" fill-opacity=".3">{{.Label}}</text>{{end}}` +
+			`<text x="{{.LabelX}}" y="{{.TextY}}" dy="-1">{{.Label}}</text>` +
+			`{{if .Gradient}}<text x="{{.MessageX}}" y="{{.TextY}}" fill="#010101" fill-opacity=".3">{{.Message}}</text>{{end}}` +
+			`<text x="{{.MessageX}}" y="{{.TextY}}" dy="-1">{{.Message}}</text>` +
+			`</g></svg>`,
+	),
+)
+
+// render renders a shields like badge, the colors must be parsed by parseColor.
+func render(label, message, labelColor, color, style string) []byte {
+	d := badgeData{
+		Label:        label,
+		Message:      message,
+		LabelColor:   labelColor,
+		Color:        color,
+		Height:       20,
+		LabelWidth:   textWidth(label) + 10,
+		MessageWidth: textWidth(message) + 10,
+		TextY:        15,
+		Radius:       3,
+		Gradient:     true,
+	}
+	switch style {
+	case "flat-square":
+		d.Radius = 0
+		d.Gradient = false
+	case "plastic":
+		d.Height = 18
+		d.TextY = 14
+		d.Radius = 4
+		d.Plastic = true
+	}
+	d.Width = d.LabelWidth + d.MessageWidth
+	d.LabelX = float64(d.LabelWidth) / 2
+	d.MessageX = float64(d.LabelWidth) + float64(d.MessageWidth)/2
+
+	var buf bytes.Buffer
+	// the data is checked, it can't fail
+	_ = badgeTemplate.Execute(&buf, d)
+	return buf.Bytes()
+}
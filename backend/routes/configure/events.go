@@ -0,0 +1,83 @@
+package configure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+)
+
+const (
+	// the live stream is polled at this interval, a ping is sent if there is nothing new
+	liveHeartbeat = 3 * time.Second
+	// Vercel functions are killed after 10 seconds, the EventSource reconnects after the stream ends,
+	// and resumes from the Last-Event-ID
+	liveDuration = 8 * time.Second
+)
+
+var liveIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// Events streams the processed events of the account and their delivery results as Server-Sent Events.
+// The messages missed between the reconnections are replayed from the Last-Event-ID.
+func Events(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	after := c.GetHeader("Last-Event-ID")
+	if !liveIDPattern.MatchString(after) {
+		var err error
+		after, err = cache.LatestLiveID(c, account)
+		if err != nil {
+			routes.Abort(c, http.StatusInternalServerError, err, "get live stream")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), liveDuration)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Render(-1, sse.Event{Event: "ready", Id: after, Data: gin.H{"account": account}})
+	c.Writer.Flush()
+
+	c.Stream(
+		func(w io.Writer) bool {
+			block := min(liveHeartbeat, time.Until(deadline))
+			// blocking for 0 means forever
+			if block < time.Millisecond {
+				return false
+			}
+			entries, err := cache.ReadLive(ctx, account, after, block)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+					log.Printf("events: read %s: %v", account, err)
+				}
+				return false
+			}
+			if len(entries) == 0 {
+				c.SSEvent("ping", gin.H{"at": time.Now().Unix()})
+				return true
+			}
+			for _, entry := range entries {
+				c.Render(-1, sse.Event{Event: entry.Message.Type, Id: entry.ID, Data: entry.Message})
+				after = entry.ID
+			}
+			return true
+		},
+	)
+}
@@ -0,0 +1,256 @@
+package configure
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+)
+
+// profiles are looked up for at most this many stargazers of a repo
+const maxExportProfiles = 1000
+
+var exportFormats = []string{"csv", "json", "ndjson"}
+
+type exportRow struct {
+	Repo   string `json:"repo"`
+	Action string `json:"action"`
+	Login  string `json:"login"`
+	// Stars of the repo after the event
+	Stars   int            `json:"stars"`
+	At      string         `json:"at"`
+	Profile *cache.Profile `json:"profile,omitempty"`
+}
+
+var exportHeader = []string{"repo", "action", "login", "stars", "at"}
+
+var profileHeader = []string{
+	"name", "company", "location", "bio", "blog", "twitter", "followers", "public_repos", "created_at",
+}
+
+func (r *exportRow) record(enrich bool) []string {
+	record := []string{r.Repo, r.Action, r.Login, strconv.Itoa(r.Stars), r.At}
+	if !enrich {
+		return record
+	}
+	p := r.Profile
+	if p == nil {
+		return append(record, make([]string, len(profileHeader))...)
+	}
+	return append(
+		record,
+		p.Name,
+		p.Company,
+		p.Location,
+		p.Bio,
+		p.Blog,
+		p.Twitter,
+		strconv.Itoa(p.Followers),
+		strconv.Itoa(p.PublicRepos),
+		time.Unix(p.CreatedAt, 0).UTC().Format(time.RFC3339),
+	)
+}
+
+// exportWriter writes the rows in one of the exportFormats.
+type exportWriter struct {
+	w      io.Writer
+	format string
+	enrich bool
+	csv    *csv.Writer
+	rows   int
+}
+
+func (e *exportWriter) begin() error {
+	switch e.format {
+	case "csv":
+		e.csv = csv.NewWriter(e.w)
+		header := exportHeader
+		if e.enrich {
+			header = append(header, profileHeader...)
+		}
+		return e.csv.Write(header)
+	case "json":
+		_, err := io.WriteString(e.w, "[")
+		return err
+	}
+	return nil
+}
+
+func (e *exportWriter) write(row *exportRow) error {
+	defer func() { e.rows++ }()
+	switch e.format {
+	case "csv":
+		return e.csv.Write(row.record(e.enrich))
+	case "json":
+		if e.rows > 0 {
+			if _, err := io.WriteString(e.w, ","); err != nil {
+				return err
+			}
+		}
+		return json.NewEncoder(e.w).Encode(row)
+	default:
+		return json.NewEncoder(e.w).Encode(row)
+	}
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+func (e *exportWriter) end() error {
+	if e.format == "json" {
+		if _, err := io.WriteString(e.w, "]\n"); err != nil {
+			return err
+		}
+	}
+	return e.flush()
+}
+
+// parseExportTime accepts a date or a RFC 3339 time, a date means the end of the day if endOfDay is set.
+func parseExportTime(value string, fallback time.Time, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		if endOfDay {
+			return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// exportProfiles looks up the profiles of the stargazers, the failed ones are left out.
+func exportProfiles(ctx context.Context, repo string, logins []string) map[string]*cache.Profile {
+	profiles := make(map[string]*cache.Profile)
+	installationID, err := cache.GetRepoInstallationID(ctx, repo)
+	if err != nil {
+		return profiles
+	}
+
+	var mu sync.Mutex
+	wg := pool.New().WithMaxGoroutines(10)
+	for _, login := range lo.Slice(lo.Uniq(logins), 0, maxExportProfiles) {
+		wg.Go(
+			func() {
+				p, err := cache.GetProfile(ctx, installationID, login)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				profiles[login] = &p
+				mu.Unlock()
+			},
+		)
+	}
+	wg.Wait()
+	return profiles
+}
+
+// Export streams the star events of the repos of an account in [from, to].
+// Query: repo (the name without the account, all repos if empty), from, to (date or RFC 3339),
+// format (csv, json, ndjson), enrich=true to add the profiles of the stargazers.
+func Export(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if !lo.Contains(exportFormats, format) {
+		routes.Abort(c, http.StatusBadRequest, nil, "invalid format")
+		return
+	}
+	now := time.Now()
+	from, err := parseExportTime(c.Query("from"), now.Add(-cache.HistoryRetention), false)
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid from")
+		return
+	}
+	to, err := parseExportTime(c.Query("to"), now, true)
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid to")
+		return
+	}
+	if from.After(to) {
+		routes.Abort(c, http.StatusBadRequest, nil, "from is after to")
+		return
+	}
+	enrich := c.Query("enrich") == "true"
+
+	repos := []string{account + "/" + c.Query("repo")}
+	if c.Query("repo") == "" {
+		repos, err = cache.HistoryRepos(c, account)
+		if err != nil {
+			routes.Abort(c, http.StatusInternalServerError, err, "get history repos")
+			return
+		}
+	}
+
+	contentType := map[string]string{
+		"csv":    "text/csv; charset=utf-8",
+		"json":   "application/json; charset=utf-8",
+		"ndjson": "application/x-ndjson; charset=utf-8",
+	}[format]
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-stars.%s"`, account, format))
+
+	// the status is sent with the first rows, later errors can only cut the response short
+	w := &exportWriter{w: c.Writer, format: format, enrich: enrich}
+	if err := w.begin(); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	for _, repo := range repos {
+		records, err := cache.GetStarHistory(c, repo, from, to)
+		if err != nil {
+			_ = c.Error(fmt.Errorf("get star history of %s: %w", repo, err))
+			return
+		}
+		var profiles map[string]*cache.Profile
+		if enrich {
+			profiles = exportProfiles(c, repo, lo.Map(records, func(r cache.StarRecord, _ int) string { return r.Sender }))
+		}
+
+		for _, r := range records {
+			row := &exportRow{
+				Repo:    repo,
+				Action:  r.Action,
+				Login:   r.Sender,
+				Stars:   r.Stars,
+				At:      time.Unix(r.At, 0).UTC().Format(time.RFC3339),
+				Profile: profiles[r.Sender],
+			}
+			if err := w.write(row); err != nil {
+				_ = c.Error(err)
+				return
+			}
+		}
+		if err := w.flush(); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.Writer.Flush()
+	}
+	if err := w.end(); err != nil {
+		_ = c.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+package configure
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+const feedTokenLength = 32
+
+// RegenerateFeedToken generates a new feed token for the account, the old feed URLs stop working.
+func RegenerateFeedToken(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	setting, err := cache.GetSettings(c, account, login)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get settings")
+		return
+	}
+	if setting == nil {
+		routes.Abort(c, http.StatusNotFound, nil, "save the settings first")
+		return
+	}
+
+	token, err := utils.GenerateRandomString(feedTokenLength)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "generate token")
+		return
+	}
+	setting.FeedToken = token
+	err = cache.SaveSettings(c, account, login, *setting)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "save settings")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
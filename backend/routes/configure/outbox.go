@@ -0,0 +1,74 @@
+package configure
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+)
+
+func GetDeadLetters(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	jobs, err := cache.GetDeadLetters(c, account)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get dead letters")
+		return
+	}
+
+	result := make([]gin.H, len(jobs))
+	for i, job := range jobs {
+		result[i] = gin.H{
+			"id":          job.DeadLetterID(),
+			"delivery_id": job.DeliveryID,
+			"event":       job.Event,
+			"attempts":    job.Attempts,
+			"last_error":  job.LastError,
+			"failed":      job.Retry,
+			"enqueued_at": job.EnqueuedAt,
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func ReplayDeadLetter(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+	id := c.Param("id")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	job, err := cache.RemoveDeadLetter(c, account, id)
+	if err == cache.ErrCacheMiss {
+		routes.Abort(c, http.StatusNotFound, err, "dead letter not found")
+		return
+	}
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "remove dead letter")
+		return
+	}
+
+	job.Attempts = 0
+	job.LastError = ""
+	job.EnqueuedAt = time.Now().Unix()
+	err = cache.Enqueue(c, *job)
+	if err != nil {
+		// put it back, so that it's not lost
+		_ = cache.DeadLetter(c, *job)
+		routes.Abort(c, http.StatusInternalServerError, err, "enqueue")
+		return
+	}
+	_ = cache.QueueDelivery(c, job.DeliveryID)
+
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -30,6 +30,26 @@ type repoPayload struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Fork        bool   `json:"fork"`
+	Archived    bool   `json:"archived"`
+	Private     bool   `json:"private"`
+}
+
+func (r repoPayload) info() cache.RepoInfo {
+	return cache.RepoInfo{FullName: r.Name, Fork: r.Fork, Archived: r.Archived, Private: r.Private}
+}
+
+// checkSetting validates the setting except the notify services, and aborts the request if it's invalid.
+func checkSetting(c *gin.Context, setting *cache.Setting) bool {
+	if len(setting.NotifySettings) > MaxSettingsCount {
+		routes.Abort(c, http.StatusBadRequest, nil, fmt.Sprintf("max settings count is %d", MaxSettingsCount))
+		return false
+	}
+
+	if err := setting.Validate(); err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid settings")
+		return false
+	}
+	return true
 }
 
 func GetSettings(c *gin.Context) {
@@ -60,10 +80,24 @@ func UpdateSettings(c *gin.Context) {
 		return
 	}
 
-	if len(setting.NotifySettings) > MaxSettingsCount {
-		routes.Abort(c, http.StatusBadRequest, nil, fmt.Sprintf("max settings count is %d", MaxSettingsCount))
+	if !checkSetting(c, &setting) {
+		return
+	}
+
+	// drop the cached notifiers, so that they are constructed with the new settings
+	prev, err := cache.GetSettings(c, account, login)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get settings")
 		return
 	}
+	if prev != nil {
+		notify.Invalidate(prev.NotifySettings)
+		// the feed token can only be changed by RegenerateFeedToken
+		setting.FeedToken = prev.FeedToken
+	} else {
+		setting.FeedToken = ""
+	}
+	notify.Invalidate(setting.NotifySettings)
 
 	// check notify settings (check token is valid too)
 	_, err = notify.GetNotifier(setting.NotifySettings)
@@ -78,6 +112,12 @@ func UpdateSettings(c *gin.Context) {
 		return
 	}
 
+	err = cache.ScheduleSetting(c, account, login, &setting, time.Now())
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "schedule setting")
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{})
 }
 
@@ -85,11 +125,21 @@ func DeleteSettings(c *gin.Context) {
 	login := c.GetString("login")
 	account := c.Param("account")
 
-	err := cache.DeleteSettings(c, account, login)
+	prev, err := cache.GetSettings(c, account, login)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get settings")
+		return
+	}
+	if prev != nil {
+		notify.Invalidate(prev.NotifySettings)
+	}
+
+	err = cache.DeleteSettings(c, account, login)
 	if err != nil {
 		routes.Abort(c, http.StatusInternalServerError, err, "delete settings")
 		return
 	}
+	_ = cache.UnscheduleSetting(c, account, login)
 
 	c.JSON(http.StatusOK, gin.H{})
 }
@@ -135,7 +185,7 @@ func getInstallationAccounts(ctx context.Context, login string) ([]string, error
 // check account is associated with login
 func checkAccountAssociation(c *gin.Context, account, login string) bool {
 	installations, err := cache.GetOrCreate(
-		c, cache.Key{"installations", login}, 24*time.Hour, func() ([]string, error) {
+		c, cache.InstallationsKey(login), 24*time.Hour, func() ([]string, error) {
 			return getInstallationAccounts(c, login)
 		},
 	)
@@ -155,6 +205,29 @@ func checkAccountAssociation(c *gin.Context, account, login string) bool {
 	return true
 }
 
+// check installation is one of the installations accessible to login
+func checkInstallation(c *gin.Context, installationID int64, login string) bool {
+	installations, err := getInstallations(c, login)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get installations")
+		return false
+	}
+	if !lo.ContainsBy(
+		installations, func(item *github.Installation) bool {
+			return item.GetID() == installationID
+		},
+	) {
+		routes.Abort(
+			c,
+			http.StatusForbidden,
+			nil,
+			fmt.Sprintf("installation %d not found, or you have no permission", installationID),
+		)
+		return false
+	}
+	return true
+}
+
 func Installations(c *gin.Context) {
 	login := c.GetString("login")
 
@@ -175,7 +248,7 @@ func Installations(c *gin.Context) {
 		accounts[i] = item.Account.GetLogin()
 	}
 
-	_ = cache.Set(c, cache.Key{"installations", login}, accounts, 24*time.Hour)
+	_ = cache.Set(c, cache.InstallationsKey(login), accounts, 24*time.Hour)
 
 	c.JSON(http.StatusOK, result)
 }
@@ -193,7 +266,7 @@ func parseInstallationID(c *gin.Context) (int64, bool) {
 func listInstallationRepos(ctx context.Context, installationID int64) ([]repoPayload, error) {
 	return cache.GetOrCreate(
 		ctx,
-		cache.Key{"installation_repos", strconv.FormatInt(installationID, 10)},
+		cache.InstallationReposKey(installationID),
 		10*time.Minute,
 		func() ([]repoPayload, error) {
 			token, err := cache.GetInstallationToken(ctx, installationID)
@@ -230,6 +303,8 @@ func serializeRepos(repos []*github.Repository) []repoPayload {
 			Name:        item.GetFullName(),
 			Description: item.GetDescription(),
 			Fork:        item.GetFork(),
+			Archived:    item.GetArchived(),
+			Private:     item.GetPrivate(),
 		}
 	}
 	return returnRepos
@@ -309,6 +384,37 @@ func SearchInstalledRepos(c *gin.Context) {
 	c.JSON(http.StatusOK, matches)
 }
 
+// FilterInstalledRepos returns the installed repos allowed by the repo filters of the setting in the body.
+func FilterInstalledRepos(c *gin.Context) {
+	installationID, ok := parseInstallationID(c)
+	if !ok {
+		return
+	}
+
+	var setting cache.Setting
+	err := c.ShouldBindJSON(&setting)
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "")
+		return
+	}
+	if !checkSetting(c, &setting) {
+		return
+	}
+
+	repos, err := listInstallationRepos(c, installationID)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "list repos")
+		return
+	}
+
+	matches := lo.Filter(
+		repos, func(repo repoPayload, _ int) bool {
+			return setting.IsAllowRepo(repo.info())
+		},
+	)
+	c.JSON(http.StatusOK, matches)
+}
+
 func CheckSettings(c *gin.Context) {
 	var setting cache.Setting
 	err := c.ShouldBindJSON(&setting)
@@ -317,8 +423,7 @@ func CheckSettings(c *gin.Context) {
 		return
 	}
 
-	if len(setting.NotifySettings) > MaxSettingsCount {
-		routes.Abort(c, http.StatusBadRequest, nil, fmt.Sprintf("max settings count is %d", MaxSettingsCount))
+	if !checkSetting(c, &setting) {
 		return
 	}
 
@@ -339,8 +444,13 @@ func TestNotify(c *gin.Context) {
 		return
 	}
 
-	if len(setting.NotifySettings) > MaxSettingsCount {
-		routes.Abort(c, http.StatusBadRequest, nil, fmt.Sprintf("max settings count is %d", MaxSettingsCount))
+	if !checkSetting(c, &setting) {
+		return
+	}
+
+	// the result is also pushed to the live stream of the account if it's given
+	account := c.Query("account")
+	if account != "" && !checkAccountAssociation(c, account, c.GetString("login")) {
 		return
 	}
 
@@ -351,6 +461,14 @@ func TestNotify(c *gin.Context) {
 	}
 
 	err = notifier.Send(c, "Test Message", utils.EscapeMarkdown("This is a test message from https://github-stargazer.vercel.app/"))
+	if account != "" {
+		msg := cache.LiveMessage{Type: cache.LiveTest, Status: "sent", At: time.Now().Unix()}
+		if err != nil {
+			msg.Status = "failed"
+			msg.Error = err.Error()
+		}
+		_ = cache.PublishLive(c, account, msg)
+	}
 	if err != nil {
 		routes.Abort(c, http.StatusInternalServerError, err, "send test notify")
 		return
@@ -0,0 +1,157 @@
+package configure
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+)
+
+const maxStatsDays = 365
+
+type statsPoint struct {
+	// The first day of the period
+	Date    string `json:"date"`
+	Created int    `json:"created"`
+	Deleted int    `json:"deleted"`
+	Net     int    `json:"net"`
+	// Stars at the end of the period, as known from the recorded events
+	Stars int `json:"stars"`
+}
+
+type statsPayload struct {
+	Repo     string       `json:"repo"`
+	Interval string       `json:"interval"`
+	Created  int          `json:"created"`
+	Deleted  int          `json:"deleted"`
+	Net      int          `json:"net"`
+	Series   []statsPoint `json:"series"`
+}
+
+// periodStart returns the start of the day or the week (Monday) of t.
+func periodStart(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if interval == "week" {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func nextPeriod(t time.Time, interval string) time.Time {
+	if interval == "week" {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// starSeries buckets the records, oldest first, into the periods from `from` to `now`.
+func starSeries(records []cache.StarRecord, from, now time.Time, interval string) []statsPoint {
+	// stars before the first record
+	stars := 0
+	if len(records) > 0 {
+		stars = records[0].Stars
+		switch records[0].Action {
+		case "created":
+			stars--
+		case "deleted":
+			stars++
+		}
+	}
+
+	var series []statsPoint
+	i := 0
+	for start := from; !start.After(now); start = nextPeriod(start, interval) {
+		end := nextPeriod(start, interval)
+		p := statsPoint{Date: start.Format(time.DateOnly)}
+		for ; i < len(records) && records[i].At < end.Unix(); i++ {
+			switch records[i].Action {
+			case "created":
+				p.Created++
+			case "deleted":
+				p.Deleted++
+			}
+			stars = records[i].Stars
+		}
+		p.Net = p.Created - p.Deleted
+		p.Stars = stars
+		series = append(series, p)
+	}
+	return series
+}
+
+// GetStats returns the daily or weekly star series of a repo in the recent days.
+func GetStats(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+	repo := account + "/" + c.Param("repo")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	days := 30
+	switch interval {
+	case "day":
+	case "week":
+		days = 12 * 7
+	default:
+		routes.Abort(c, http.StatusBadRequest, nil, "invalid interval")
+		return
+	}
+	if daysStr := c.Query("days"); daysStr != "" {
+		value, err := strconv.Atoi(daysStr)
+		if err != nil || value < 1 || value > maxStatsDays {
+			routes.Abort(c, http.StatusBadRequest, nil, "invalid days")
+			return
+		}
+		days = value
+	}
+	loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		routes.Abort(c, http.StatusBadRequest, err, "invalid tz")
+		return
+	}
+
+	now := time.Now().In(loc)
+	from := periodStart(now.AddDate(0, 0, -(days-1)), interval)
+	records, err := cache.GetStarHistory(c, repo, from, now)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get star history")
+		return
+	}
+
+	result := statsPayload{
+		Repo:     repo,
+		Interval: interval,
+		Series:   starSeries(records, from, now, interval),
+	}
+	for _, p := range result.Series {
+		result.Created += p.Created
+		result.Deleted += p.Deleted
+	}
+	result.Net = result.Created - result.Deleted
+	c.JSON(http.StatusOK, result)
+}
+
+// QueueBackfill asks to backfill the star history of the repos of the installation.
+func QueueBackfill(c *gin.Context) {
+	installationID, ok := parseInstallationID(c)
+	if !ok {
+		return
+	}
+	if !checkInstallation(c, installationID, c.GetString("login")) {
+		return
+	}
+
+	err := cache.QueueBackfill(c, installationID)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "queue backfill")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{})
+}
@@ -0,0 +1,89 @@
+package configure
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+func TestStarSeries(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("load timezone: %v", err)
+	}
+	// 2026-10-19 is a Monday
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, 10, day, hour, 0, 0, 0, shanghai)
+	}
+	record := func(action string, stars int, t time.Time) cache.StarRecord {
+		return cache.StarRecord{Action: action, Stars: stars, At: t.Unix()}
+	}
+
+	tests := []struct {
+		name     string
+		records  []cache.StarRecord
+		from     time.Time
+		now      time.Time
+		interval string
+		// date created/deleted/net/stars of each point
+		want string
+	}{
+		{
+			name:     "no records",
+			from:     at(19, 0),
+			now:      at(21, 10),
+			interval: "day",
+			want:     "2026-10-19 0/0/0/0, 2026-10-20 0/0/0/0, 2026-10-21 0/0/0/0",
+		},
+		{
+			name: "days",
+			records: []cache.StarRecord{
+				record("created", 11, at(19, 8)),
+				record("created", 12, at(19, 23)),
+				record("deleted", 11, at(21, 0)),
+				record("created", 12, at(21, 9)),
+			},
+			from:     at(19, 0),
+			now:      at(21, 10),
+			interval: "day",
+			want:     "2026-10-19 2/0/2/12, 2026-10-20 0/0/0/12, 2026-10-21 1/1/0/12",
+		},
+		{
+			name:     "stars before the first unstar",
+			records:  []cache.StarRecord{record("deleted", 41, at(20, 12))},
+			from:     at(19, 0),
+			now:      at(20, 13),
+			interval: "day",
+			want:     "2026-10-19 0/0/0/42, 2026-10-20 0/1/-1/41",
+		},
+		{
+			name: "weeks",
+			records: []cache.StarRecord{
+				record("created", 101, at(12, 10)),
+				record("created", 102, at(18, 23)),
+				record("created", 103, at(19, 0)),
+				record("deleted", 102, at(20, 0)),
+			},
+			from:     periodStart(at(14, 15), "week"),
+			now:      at(21, 10),
+			interval: "week",
+			want:     "2026-10-12 2/0/2/102, 2026-10-19 1/1/0/102",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				var points []string
+				for _, p := range starSeries(tt.records, tt.from, tt.now, tt.interval) {
+					points = append(points, fmt.Sprintf("%s %d/%d/%d/%d", p.Date, p.Created, p.Deleted, p.Net, p.Stars))
+				}
+				if got := strings.Join(points, ", "); got != tt.want {
+					t.Errorf("starSeries() = %s, want %s", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,48 @@
+package configure
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+	"github.com/j178/github_stargazer/backend/suspicion"
+)
+
+const maxSuspicionDays = 30
+
+// GetSuspicion scores the recent stargazers of a repo for signs of a fake star campaign.
+func GetSuspicion(c *gin.Context) {
+	login := c.GetString("login")
+	account := c.Param("account")
+	repo := account + "/" + c.Param("repo")
+
+	if !checkAccountAssociation(c, account, login) {
+		return
+	}
+
+	days := cache.SuspicionDays
+	if daysStr := c.Query("days"); daysStr != "" {
+		value, err := strconv.Atoi(daysStr)
+		if err != nil || value < 1 || value > maxSuspicionDays {
+			routes.Abort(c, http.StatusBadRequest, nil, "invalid days")
+			return
+		}
+		days = value
+	}
+
+	installationID, err := cache.GetRepoInstallationID(c, repo)
+	if err != nil {
+		routes.Abort(c, http.StatusNotFound, err, "get installation")
+		return
+	}
+	report, err := suspicion.Analyze(c, installationID, repo, days, time.Now())
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "analyze stargazers")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
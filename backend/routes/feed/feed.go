@@ -0,0 +1,192 @@
+package feed
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+const (
+	feedPeriod   = 30 * 24 * time.Hour
+	maxFeedItems = 50
+)
+
+// item is a star event of a repo, with the profile of the stargazer if it's found.
+type item struct {
+	repo string
+	cache.StarRecord
+	profile *cache.Profile
+}
+
+func (i *item) id() string {
+	return fmt.Sprintf("urn:github-stargazer:%s:%s:%s:%d", i.Action, i.repo, i.Sender, i.At)
+}
+
+func (i *item) title() string {
+	verb := "starred"
+	if i.Action == "deleted" {
+		verb = "unstarred"
+	}
+	return fmt.Sprintf("%s %s %s", i.Sender, verb, i.repo)
+}
+
+func (i *item) url() string {
+	if i.profile != nil && i.profile.HTMLURL != "" {
+		return i.profile.HTMLURL
+	}
+	return "https://github.com/" + i.Sender
+}
+
+// summary describes the stargazer in plain text.
+func (i *item) summary() string {
+	lines := []string{fmt.Sprintf("%s now has %s stars.", i.repo, utils.FormatNumber(i.Stars))}
+	if p := i.profile; p != nil {
+		if p.Name != "" {
+			lines = append(lines, "Name: "+p.Name)
+		}
+		if p.Bio != "" {
+			lines = append(lines, "Bio: "+p.Bio)
+		}
+		if p.Company != "" {
+			lines = append(lines, "Company: "+p.Company)
+		}
+		if p.Location != "" {
+			lines = append(lines, "Location: "+p.Location)
+		}
+		lines = append(
+			lines,
+			fmt.Sprintf(
+				"%s followers, %s public repos",
+				utils.FormatCompact(p.Followers),
+				utils.FormatCompact(p.PublicRepos),
+			),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findSetting returns the setting of the account whose feed token is the given one.
+func findSetting(settings map[string]*cache.Setting, token string) *cache.Setting {
+	for _, s := range settings {
+		if s.FeedToken != "" && subtle.ConstantTimeCompare([]byte(s.FeedToken), []byte(token)) == 1 {
+			return s
+		}
+	}
+	return nil
+}
+
+// recentItems returns the latest star events of the repos allowed by the setting, the latest first.
+func recentItems(ctx context.Context, account string, setting *cache.Setting, now time.Time) ([]*item, error) {
+	repos, err := cache.HistoryRepos(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("get history repos: %w", err)
+	}
+
+	var items []*item
+	for _, repo := range repos {
+		ok, err := setting.IsAllowRepoName(ctx, repo)
+		if err != nil {
+			// hidden, it may be excluded
+			log.Printf("feed: get repo %s: %v", repo, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		records, err := cache.GetStarHistory(ctx, repo, now.Add(-feedPeriod), now)
+		if err != nil {
+			return nil, fmt.Errorf("get star history of %s: %w", repo, err)
+		}
+		for _, r := range records {
+			items = append(items, &item{repo: repo, StarRecord: r})
+		}
+	}
+	slices.SortFunc(
+		items, func(a, b *item) int {
+			return cmp.Compare(b.At, a.At)
+		},
+	)
+	items = lo.Slice(items, 0, maxFeedItems)
+
+	var mu sync.Mutex
+	wg := pool.New().WithMaxGoroutines(10)
+	for _, it := range items {
+		wg.Go(
+			func() {
+				installationID, err := cache.GetRepoInstallationID(ctx, it.repo)
+				if err != nil {
+					log.Printf("feed: get installation of %s: %v", it.repo, err)
+					return
+				}
+				p, err := cache.GetProfile(ctx, installationID, it.Sender)
+				if err != nil {
+					log.Printf("feed: get profile of %s: %v", it.Sender, err)
+					return
+				}
+				mu.Lock()
+				it.profile = &p
+				mu.Unlock()
+			},
+		)
+	}
+	wg.Wait()
+	return items, nil
+}
+
+// Feed serves the recent star events of an account as an Atom feed or a JSON Feed,
+// e.g. `/api/feed/j178.atom?token=...`, `/api/feed/j178.json?token=...`.
+func Feed(c *gin.Context) {
+	name := c.Param("account")
+	var account, format string
+	if a, ok := strings.CutSuffix(name, ".atom"); ok {
+		account, format = a, "atom"
+	} else if a, ok := strings.CutSuffix(name, ".json"); ok {
+		account, format = a, "json"
+	} else {
+		routes.Abort(c, http.StatusNotFound, nil, "feed must end with .atom or .json")
+		return
+	}
+
+	settings, err := cache.GetAllSettings(c, account)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get settings")
+		return
+	}
+	setting := findSetting(settings, c.Query("token"))
+	if setting == nil {
+		routes.Abort(c, http.StatusNotFound, nil, "feed not found")
+		return
+	}
+
+	now := time.Now()
+	items, err := recentItems(c, account, setting, now)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "get recent stars")
+		return
+	}
+
+	// the token is part of the feed URL
+	self := fmt.Sprintf("%s://%s%s", utils.RequestScheme(c), c.Request.Host, c.Request.URL.RequestURI())
+	c.Header("Cache-Control", "private, max-age=300")
+	switch format {
+	case "atom":
+		c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", renderAtom(account, self, items, now))
+	case "json":
+		c.Data(http.StatusOK, "application/feed+json; charset=utf-8", renderJSON(account, self, items))
+	}
+}
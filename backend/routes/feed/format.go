@@ -0,0 +1,130 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+)
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Link    atomLink   `xml:"link"`
+	Author  atomPerson `xml:"author"`
+	Summary atomText   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func feedTitle(account string) string {
+	return "Stargazers of " + account
+}
+
+func renderAtom(account, self string, items []*item, now time.Time) []byte {
+	updated := now
+	if len(items) > 0 {
+		updated = time.Unix(items[0].At, 0)
+	}
+	feed := atomFeed{
+		ID:      "urn:github-stargazer:feed:" + account,
+		Title:   feedTitle(account),
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: "https://github.com/" + account, Rel: "alternate"},
+		},
+	}
+	for _, it := range items {
+		feed.Entries = append(
+			feed.Entries, atomEntry{
+				ID:      it.id(),
+				Title:   it.title(),
+				Updated: time.Unix(it.At, 0).UTC().Format(time.RFC3339),
+				Link:    atomLink{Href: it.url(), Rel: "alternate"},
+				Author:  atomPerson{Name: it.Sender, URI: it.url()},
+				Summary: atomText{Type: "text", Body: it.summary()},
+			},
+		)
+	}
+	// the structs always marshal
+	body, _ := xml.MarshalIndent(feed, "", "  ")
+	return append([]byte(xml.Header), body...)
+}
+
+type jsonAuthor struct {
+	Name   string `json:"name"`
+	URL    string `json:"url,omitempty"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentText   string       `json:"content_text"`
+	DatePublished string       `json:"date_published"`
+	Authors       []jsonAuthor `json:"authors"`
+	Tags          []string     `json:"tags"`
+}
+
+type jsonFeed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url"`
+	Items       []jsonItem `json:"items"`
+}
+
+// renderJSON renders a JSON Feed 1.1, see https://www.jsonfeed.org/version/1.1/
+func renderJSON(account, self string, items []*item) []byte {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feedTitle(account),
+		HomePageURL: "https://github.com/" + account,
+		FeedURL:     self,
+		Items:       []jsonItem{},
+	}
+	for _, it := range items {
+		author := jsonAuthor{Name: it.Sender, URL: it.url()}
+		if it.profile != nil {
+			author.Avatar = it.profile.AvatarURL
+		}
+		feed.Items = append(
+			feed.Items, jsonItem{
+				ID:            it.id(),
+				URL:           it.url(),
+				Title:         it.title(),
+				ContentText:   it.summary(),
+				DatePublished: time.Unix(it.At, 0).UTC().Format(time.RFC3339),
+				Authors:       []jsonAuthor{author},
+				Tags:          []string{it.Action, it.repo},
+			},
+		)
+	}
+	body, _ := json.Marshal(feed)
+	return body
+}
@@ -0,0 +1,262 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+const (
+	backfillPerPage = 100
+	// leave some requests of the rate limit to the notifications
+	backfillRateReserve = 100
+)
+
+// rateLimitedError stops the backfill of an installation until the rate limit is reset.
+type rateLimitedError struct {
+	reset time.Time
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited until %s", e.reset.Format(time.RFC3339))
+}
+
+// checkRate converts the rate limit errors of GitHub to rateLimitedError,
+// and returns one too if the remaining requests are running out.
+func checkRate(resp *github.Response, err error) error {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return &rateLimitedError{reset: rateErr.Rate.Reset.Time}
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return &rateLimitedError{reset: time.Now().Add(abuseErr.GetRetryAfter())}
+	}
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.Rate.Limit > 0 && resp.Rate.Remaining < backfillRateReserve {
+		return &rateLimitedError{reset: resp.Rate.Reset.Time}
+	}
+	return nil
+}
+
+// backfillStore keeps the cursors and the star history of the backfilled repos.
+type backfillStore interface {
+	GetCursor(ctx context.Context, repo string) (cache.BackfillCursor, error)
+	SaveCursor(ctx context.Context, repo string, cursor cache.BackfillCursor) error
+	FirstRecord(ctx context.Context, repo string) (*cache.StarRecord, error)
+	AddRecords(ctx context.Context, repo string, records []cache.StarRecord) error
+}
+
+// cacheBackfillStore is the backfillStore in Redis.
+type cacheBackfillStore struct{}
+
+func (cacheBackfillStore) GetCursor(ctx context.Context, repo string) (cache.BackfillCursor, error) {
+	return cache.GetBackfillCursor(ctx, repo)
+}
+
+func (cacheBackfillStore) SaveCursor(ctx context.Context, repo string, cursor cache.BackfillCursor) error {
+	return cache.SaveBackfillCursor(ctx, repo, cursor)
+}
+
+func (cacheBackfillStore) FirstRecord(ctx context.Context, repo string) (*cache.StarRecord, error) {
+	return cache.FirstStarRecord(ctx, repo)
+}
+
+func (cacheBackfillStore) AddRecords(ctx context.Context, repo string, records []cache.StarRecord) error {
+	return cache.AddStarRecords(ctx, repo, records)
+}
+
+// backfiller backfills the star history of repos from the stargazers API.
+// The client can point to a fake GitHub API server by setting its BaseURL.
+type backfiller struct {
+	client *github.Client
+	store  backfillStore
+	now    func() time.Time
+}
+
+func newBackfiller(ctx context.Context, installationID int64) (*backfiller, error) {
+	token, err := cache.GetInstallationToken(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	return &backfiller{
+		client: github.NewClient(nil).WithAuthToken(token),
+		store:  cacheBackfillStore{},
+		now:    time.Now,
+	}, nil
+}
+
+// repos returns the repos that the installation has access to.
+func (b *backfiller) repos(ctx context.Context) ([]*github.Repository, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var repos []*github.Repository
+	for {
+		list, resp, err := b.client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, checkRate(resp, err)
+		}
+		repos = append(repos, list.Repositories...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return repos, nil
+}
+
+// backfillRepo pages through the stargazers of the repo from its cursor, until it's done or interrupted.
+// The star count of a record is the position of the stargazer, the unstars before it are unknown.
+func (b *backfiller) backfillRepo(ctx context.Context, repo *github.Repository) error {
+	name := repo.GetFullName()
+	cursor, err := b.store.GetCursor(ctx, name)
+	if err != nil {
+		return fmt.Errorf("get cursor: %w", err)
+	}
+	if cursor.Done {
+		return nil
+	}
+	if cursor.Page == 0 {
+		cursor.Page = 1
+		cursor.Until = b.now().Unix()
+		first, err := b.store.FirstRecord(ctx, name)
+		if err != nil {
+			return fmt.Errorf("get first record: %w", err)
+		}
+		if first != nil {
+			cursor.Until = first.At
+		}
+	}
+	cutoff := b.now().Add(-cache.HistoryRetention).Unix()
+
+	for ctx.Err() == nil {
+		list, resp, err := b.client.Activity.ListStargazers(
+			ctx,
+			repo.Owner.GetLogin(),
+			repo.GetName(),
+			&github.ListOptions{Page: cursor.Page, PerPage: backfillPerPage},
+		)
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusUnprocessableEntity {
+			// GitHub doesn't page beyond 40,000 stargazers
+			log.Printf("backfill: %s stops at page %d: %v", name, cursor.Page, err)
+			cursor.Done = true
+			return b.store.SaveCursor(ctx, name, cursor)
+		}
+		if err != nil {
+			return checkRate(resp, err)
+		}
+
+		records := make([]cache.StarRecord, 0, len(list))
+		for i, s := range list {
+			at := s.GetStarredAt().Unix()
+			if at >= cursor.Until {
+				cursor.Done = true
+				break
+			}
+			if at < cutoff {
+				continue
+			}
+			records = append(
+				records, cache.StarRecord{
+					Action: "created",
+					Sender: s.User.GetLogin(),
+					Stars:  (cursor.Page-1)*backfillPerPage + i + 1,
+					At:     at,
+				},
+			)
+		}
+		if err := b.store.AddRecords(ctx, name, records); err != nil {
+			return fmt.Errorf("add records: %w", err)
+		}
+
+		if resp.NextPage == 0 {
+			cursor.Done = true
+		} else {
+			cursor.Page = resp.NextPage
+		}
+		if err := b.store.SaveCursor(ctx, name, cursor); err != nil {
+			return fmt.Errorf("save cursor: %w", err)
+		}
+		if cursor.Done {
+			return nil
+		}
+		if err := checkRate(resp, nil); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// backfillInstallation backfills the repos of the installation, returns whether all of them are done.
+func backfillInstallation(ctx context.Context, b *backfiller) (bool, error) {
+	repos, err := b.repos(ctx)
+	if err != nil {
+		return false, fmt.Errorf("list repos: %w", err)
+	}
+
+	done := true
+	for _, repo := range repos {
+		err := b.backfillRepo(ctx, repo)
+		var rateErr *rateLimitedError
+		if errors.As(err, &rateErr) || ctx.Err() != nil {
+			return false, err
+		}
+		if err != nil {
+			log.Printf("backfill: %s: %v", repo.GetFullName(), err)
+			done = false
+		}
+	}
+	return done, nil
+}
+
+// Backfill backfills the star history of the pending installations, returns the number of finished installations.
+func Backfill(ctx context.Context) (int, error) {
+	ids, err := cache.PendingBackfills(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pending backfills: %w", err)
+	}
+
+	n := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		if paused, err := cache.BackfillPaused(ctx, id); err != nil || paused {
+			continue
+		}
+
+		b, err := newBackfiller(ctx, id)
+		if err != nil {
+			log.Printf("backfill: installation %d: %v", id, err)
+			continue
+		}
+		done, err := backfillInstallation(ctx, b)
+		var rateErr *rateLimitedError
+		if errors.As(err, &rateErr) {
+			log.Printf("backfill: installation %d: %v", id, err)
+			_ = cache.PauseBackfill(ctx, id, rateErr.reset)
+			continue
+		}
+		if err != nil {
+			log.Printf("backfill: installation %d: %v", id, err)
+			continue
+		}
+		if done {
+			if err := cache.FinishBackfill(ctx, id); err != nil {
+				log.Printf("backfill: finish installation %d: %v", id, err)
+				continue
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,275 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+// memoryBackfillStore is the backfillStore in memory.
+type memoryBackfillStore struct {
+	cursors map[string]cache.BackfillCursor
+	records map[string][]cache.StarRecord
+}
+
+func newMemoryBackfillStore() *memoryBackfillStore {
+	return &memoryBackfillStore{
+		cursors: make(map[string]cache.BackfillCursor),
+		records: make(map[string][]cache.StarRecord),
+	}
+}
+
+func (s *memoryBackfillStore) GetCursor(_ context.Context, repo string) (cache.BackfillCursor, error) {
+	return s.cursors[repo], nil
+}
+
+func (s *memoryBackfillStore) SaveCursor(_ context.Context, repo string, cursor cache.BackfillCursor) error {
+	s.cursors[repo] = cursor
+	return nil
+}
+
+func (s *memoryBackfillStore) FirstRecord(_ context.Context, repo string) (*cache.StarRecord, error) {
+	var first *cache.StarRecord
+	for i, r := range s.records[repo] {
+		if first == nil || r.At < first.At {
+			first = &s.records[repo][i]
+		}
+	}
+	return first, nil
+}
+
+func (s *memoryBackfillStore) AddRecords(_ context.Context, repo string, records []cache.StarRecord) error {
+	s.records[repo] = append(s.records[repo], records...)
+	return nil
+}
+
+// fakeStargazers serves the stargazers of owner/repo, starred one per minute from start.
+type fakeStargazers struct {
+	start time.Time
+	count int
+	// the response of a page, to override the normal one
+	fail func(w http.ResponseWriter, page int) bool
+	// the pages requested
+	pages []int
+}
+
+func (f *fakeStargazers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/repos/owner/repo/stargazers" {
+		http.NotFound(w, r)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	f.pages = append(f.pages, page)
+	if f.fail != nil && f.fail(w, page) {
+		return
+	}
+
+	var list []map[string]any
+	for i := (page - 1) * perPage; i < min(page*perPage, f.count); i++ {
+		list = append(
+			list, map[string]any{
+				"starred_at": f.start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+				"user":       map[string]any{"login": fmt.Sprintf("user%d", i+1)},
+			},
+		)
+	}
+	if page*perPage < f.count {
+		next := url.URL{Path: r.URL.Path, RawQuery: fmt.Sprintf("page=%d&per_page=%d", page+1, perPage)}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.String()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func newTestBackfiller(t *testing.T, f *fakeStargazers, store backfillStore, now time.Time) *backfiller {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(srv.URL + "/")
+	return &backfiller{client: client, store: store, now: func() time.Time { return now }}
+}
+
+func testRepo() *github.Repository {
+	return &github.Repository{
+		Name:     github.Ptr("repo"),
+		FullName: github.Ptr("owner/repo"),
+		Owner:    &github.User{Login: github.Ptr("owner")},
+	}
+}
+
+func TestBackfillRepoPages(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	f := &fakeStargazers{start: start, count: 250}
+	store := newMemoryBackfillStore()
+	b := newTestBackfiller(t, f, store, start.Add(12*time.Hour))
+
+	if err := b.backfillRepo(t.Context(), testRepo()); err != nil {
+		t.Fatalf("backfillRepo: %v", err)
+	}
+
+	if fmt.Sprint(f.pages) != "[1 2 3]" {
+		t.Errorf("pages = %v, want [1 2 3]", f.pages)
+	}
+	records := store.records["owner/repo"]
+	if len(records) != 250 {
+		t.Fatalf("records = %d, want 250", len(records))
+	}
+	for i, r := range records {
+		if r.Stars != i+1 || r.Sender != fmt.Sprintf("user%d", i+1) || r.Action != "created" {
+			t.Fatalf("records[%d] = %+v", i, r)
+		}
+	}
+	if cursor := store.cursors["owner/repo"]; !cursor.Done {
+		t.Errorf("cursor = %+v, want done", cursor)
+	}
+
+	// done repos are not requested again
+	f.pages = nil
+	if err := b.backfillRepo(t.Context(), testRepo()); err != nil {
+		t.Fatalf("backfillRepo again: %v", err)
+	}
+	if len(f.pages) != 0 {
+		t.Errorf("pages = %v, want none", f.pages)
+	}
+}
+
+func TestBackfillRepoResume(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	f := &fakeStargazers{start: start, count: 250}
+	store := newMemoryBackfillStore()
+	// interrupted after the first page, the stars from the 220th are recorded by the webhook
+	until := start.Add(219 * time.Minute).Unix()
+	store.cursors["owner/repo"] = cache.BackfillCursor{Page: 2, Until: until}
+	b := newTestBackfiller(t, f, store, start.Add(12*time.Hour))
+
+	if err := b.backfillRepo(t.Context(), testRepo()); err != nil {
+		t.Fatalf("backfillRepo: %v", err)
+	}
+
+	if fmt.Sprint(f.pages) != "[2 3]" {
+		t.Errorf("pages = %v, want [2 3]", f.pages)
+	}
+	records := store.records["owner/repo"]
+	if len(records) != 119 {
+		t.Fatalf("records = %d, want 119", len(records))
+	}
+	if first, last := records[0], records[len(records)-1]; first.Stars != 101 || last.Stars != 219 || last.At >= until {
+		t.Errorf("records from %+v to %+v", first, last)
+	}
+	if cursor := store.cursors["owner/repo"]; !cursor.Done {
+		t.Errorf("cursor = %+v, want done", cursor)
+	}
+}
+
+func TestBackfillRepoStopsAtPageLimit(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	f := &fakeStargazers{
+		start: start,
+		count: 250,
+		fail: func(w http.ResponseWriter, page int) bool {
+			if page < 2 {
+				return false
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"message":"In order to keep the API fast for everyone, pagination is limited for this resource."}`))
+			return true
+		},
+	}
+	store := newMemoryBackfillStore()
+	b := newTestBackfiller(t, f, store, start.Add(12*time.Hour))
+
+	if err := b.backfillRepo(t.Context(), testRepo()); err != nil {
+		t.Fatalf("backfillRepo: %v", err)
+	}
+
+	if n := len(store.records["owner/repo"]); n != 100 {
+		t.Errorf("records = %d, want 100", n)
+	}
+	if cursor := store.cursors["owner/repo"]; !cursor.Done || cursor.Page != 2 {
+		t.Errorf("cursor = %+v, want done at page 2", cursor)
+	}
+}
+
+func TestBackfillRepoRateLimited(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	rateHeaders := func(w http.ResponseWriter, remaining int) {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	}
+
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter, page int) bool
+		// the page to resume from
+		page    int
+		records int
+	}{
+		{
+			name: "running out",
+			fail: func(w http.ResponseWriter, page int) bool {
+				// the first page is saved, then stops for the reserve
+				rateHeaders(w, backfillRateReserve-1)
+				return false
+			},
+			page:    2,
+			records: 100,
+		},
+		{
+			name: "exceeded",
+			fail: func(w http.ResponseWriter, page int) bool {
+				if page < 2 {
+					rateHeaders(w, 1000)
+					return false
+				}
+				rateHeaders(w, 0)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"message":"API rate limit exceeded"}`))
+				return true
+			},
+			page:    2,
+			records: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				start := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+				f := &fakeStargazers{start: start, count: 250, fail: tt.fail}
+				store := newMemoryBackfillStore()
+				b := newTestBackfiller(t, f, store, start.Add(12*time.Hour))
+
+				err := b.backfillRepo(t.Context(), testRepo())
+				var rateErr *rateLimitedError
+				if !errors.As(err, &rateErr) {
+					t.Fatalf("err = %v, want rateLimitedError", err)
+				}
+				if !rateErr.reset.Equal(reset) {
+					t.Errorf("reset = %s, want %s", rateErr.reset, reset)
+				}
+				if n := len(store.records["owner/repo"]); n != tt.records {
+					t.Errorf("records = %d, want %d", n, tt.records)
+				}
+				if cursor := store.cursors["owner/repo"]; cursor.Done || cursor.Page != tt.page {
+					t.Errorf("cursor = %+v, want page %d", cursor, tt.page)
+				}
+			},
+		)
+	}
+}
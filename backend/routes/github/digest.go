@@ -0,0 +1,191 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/notify"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+const (
+	digestTopStargazers = 5
+	digestRetryDelay    = 5 * time.Minute
+)
+
+type repoDigest struct {
+	repo       string
+	url        string
+	net        int
+	stars      int
+	stargazers []cache.DigestEntry
+}
+
+func formatNet(n int) string {
+	if n > 0 {
+		return "\\+" + utils.FormatNumber(n)
+	}
+	return utils.EscapeMarkdown(utils.FormatNumber(n))
+}
+
+func composeDigest(entries []cache.DigestEntry) (string, string) {
+	var repos []*repoDigest
+	var others []string
+	byRepo := make(map[string]*repoDigest)
+	total := 0
+	for _, entry := range entries {
+		if entry.Action != "created" && entry.Action != "deleted" {
+			others = append(others, entry.Summary)
+			continue
+		}
+		d, ok := byRepo[entry.Repo]
+		if !ok {
+			d = &repoDigest{repo: entry.Repo, url: entry.RepoURL}
+			byRepo[entry.Repo] = d
+			repos = append(repos, d)
+		}
+		d.stars = entry.Stars
+		switch entry.Action {
+		case "created":
+			d.net++
+			total++
+			d.stargazers = append(d.stargazers, entry)
+		case "deleted":
+			d.net--
+			total--
+		}
+	}
+
+	title := fmt.Sprintf("GitHub Star Digest: %s stars on %d repos", formatNet(total), len(repos))
+	lines := make([]string, 0, len(repos))
+	for _, d := range repos {
+		line := fmt.Sprintf(
+			"[%s](%s) %s stars \\(now **%s**\\)",
+			utils.EscapeMarkdown(d.repo),
+			utils.EscapeMarkdown(d.url),
+			formatNet(d.net),
+			utils.EscapeMarkdown(utils.FormatNumber(d.stars)),
+		)
+
+		// the latest ones first
+		stargazers := slices.Clone(d.stargazers)
+		slices.Reverse(stargazers)
+		stargazers = lo.UniqBy(stargazers, func(e cache.DigestEntry) string { return e.Sender })
+		if len(stargazers) > 0 {
+			names := lo.Map(
+				lo.Slice(stargazers, 0, digestTopStargazers), func(e cache.DigestEntry, _ int) string {
+					return fmt.Sprintf("[%s](%s)", utils.EscapeMarkdown(e.Sender), utils.EscapeMarkdown(e.SenderURL))
+				},
+			)
+			line += ", top new stargazers: " + strings.Join(names, ", ")
+			if len(stargazers) > digestTopStargazers {
+				line += utils.EscapeMarkdown(fmt.Sprintf(" and %d more", len(stargazers)-digestTopStargazers))
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(others) > 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, others...)
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+// digestSetting looks up the current setting and notify setting of the digest channel.
+func digestSetting(ctx context.Context, ch cache.DigestChannel) (*cache.Setting, map[string]string, error) {
+	login, id, ok := parseChannelID(ch.Channel)
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid channel: %s", ch.Channel)
+	}
+	setting, err := cache.GetSettings(ctx, ch.Account, login)
+	if err != nil {
+		return nil, nil, err
+	}
+	if setting == nil {
+		return nil, nil, nil
+	}
+	index := setting.ChannelIndex(id)
+	if index < 0 {
+		return nil, nil, nil
+	}
+	return setting, setting.NotifySettings[index], nil
+}
+
+func flushDigest(ctx context.Context, ch cache.DigestChannel, now time.Time) error {
+	setting, ns, err := digestSetting(ctx, ch)
+	if err != nil {
+		_ = cache.DelayDigest(ctx, ch, now.Add(digestRetryDelay))
+		return err
+	}
+
+	silent := false
+	if ns != nil {
+		if until, quiet := setting.QuietUntil(now); quiet {
+			if !setting.IsSilent() || !notify.SupportsSilent(ns) {
+				// hold it until the quiet hours end
+				return cache.DelayDigest(ctx, ch, until)
+			}
+			silent = true
+		}
+	}
+
+	entries, err := cache.TakeDigest(ctx, ch, now)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if ns == nil {
+		log.Printf("digest: channel %s of %s is gone, drop %d entries", ch.Channel, ch.Account, len(entries))
+		return nil
+	}
+
+	notifier, err := notify.GetNotifier([]map[string]string{ns})
+	if err == nil {
+		title, content := composeDigest(entries)
+		if silent {
+			err = errors.Join(notifier.SendAllSilent(ctx, title, content)...)
+		} else {
+			err = notifier.Send(ctx, title, content)
+		}
+	}
+	if err != nil {
+		// put them back to be sent later, ahead of the entries added since
+		if err := cache.RequeueDigest(ctx, ch, now.Add(digestRetryDelay), entries); err != nil {
+			log.Printf("digest: requeue %d entries of %s: %v", len(entries), ch.Channel, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// FlushDigests sends the due digests, returns the number of flushed channels.
+func FlushDigests(ctx context.Context) (int, error) {
+	now := time.Now()
+	channels, err := cache.DueDigests(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("list due digests: %w", err)
+	}
+
+	n := 0
+	for _, ch := range channels {
+		err := flushDigest(ctx, ch, now)
+		if err != nil {
+			log.Printf("digest: flush %s of %s: %v", ch.Channel, ch.Account, err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
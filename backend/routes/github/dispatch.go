@@ -0,0 +1,275 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/notify"
+)
+
+// notification is an event to be sent to the channels of the settings.
+type notification struct {
+	// created, deleted, milestone, fork, release, sponsorship or discussion, see cache.Route*
+	kind string
+	// the account whose settings receive the notification
+	account string
+	// nil if the event is not about a repo
+	repo           *github.Repository
+	sender         *github.User
+	installationID int64
+	title          string
+	content        string
+	// composes the title and content with the profile of the sender, for the settings with `enrich_profile`
+	enrich func(p cache.Profile) (string, string)
+	// bypasses the digests and quiet hours
+	urgent bool
+	// appended to the channel IDs, so that it's retried separately from other notifications of the same delivery
+	channelSuffix string
+}
+
+func (n *notification) repoName() string {
+	if n.repo == nil {
+		return ""
+	}
+	return n.repo.GetFullName()
+}
+
+func (n *notification) digestEntry() cache.DigestEntry {
+	entry := cache.DigestEntry{
+		Action:    n.kind,
+		Sender:    n.sender.GetLogin(),
+		SenderURL: n.sender.GetHTMLURL(),
+		At:        time.Now().Unix(),
+	}
+	if n.repo != nil {
+		entry.Repo = n.repo.GetFullName()
+		entry.RepoURL = n.repo.GetHTMLURL()
+		entry.Stars = n.repo.GetStargazersCount()
+	}
+	if n.kind != cache.RouteCreated && n.kind != cache.RouteDeleted {
+		entry.Summary = n.content
+	}
+	return entry
+}
+
+// channelID identifies a notify setting of a login by its stable ID, used to retry only the failed channels.
+func channelID(login string, index int, ns map[string]string) string {
+	id := ns[cache.ChannelIDKey]
+	if id == "" {
+		id = strconv.Itoa(index)
+	}
+	return login + "#" + id
+}
+
+// parseChannelID returns the login and the notify setting ID, see Setting.ChannelIndex.
+func parseChannelID(channel string) (string, string, bool) {
+	login, id, ok := strings.Cut(channel, "#")
+	if !ok || id == "" {
+		return "", "", false
+	}
+	return login, id, true
+}
+
+// claimAlert claims the alert of the kind on the repo for the login before sending it, see cache.ClaimAlert.
+func claimAlert(ctx context.Context, kind, repo, login string, cooldown time.Duration) bool {
+	ok, err := cache.ClaimAlert(ctx, kind, repo, login, cooldown)
+	if err != nil {
+		log.Printf("%s: claim %s: %v", kind, repo, err)
+		return false
+	}
+	return ok
+}
+
+// channelGroup is a group of channels sent together.
+type channelGroup struct {
+	channels []string
+	settings []map[string]string
+}
+
+func (g *channelGroup) add(channel string, setting map[string]string) {
+	g.channels = append(g.channels, channel)
+	g.settings = append(g.settings, setting)
+}
+
+// send sends the message to the channels of the group, returns the failed channels and their errors.
+func (g *channelGroup) send(ctx context.Context, title, content string, silent bool) ([]string, []error) {
+	if len(g.channels) == 0 {
+		return nil, nil
+	}
+
+	notifier, err := notify.GetNotifier(g.settings)
+	if err != nil {
+		return g.channels, []error{err}
+	}
+
+	var errs []error
+	if silent {
+		errs = notifier.SendAllSilent(ctx, title, content)
+	} else {
+		errs = notifier.SendAll(ctx, title, content)
+	}
+
+	var failed []string
+	var failedErrs []error
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, g.channels[i])
+			failedErrs = append(failedErrs, err)
+		}
+	}
+	return failed, failedErrs
+}
+
+// notifyAll sends the notification to the settings accepted by `accept`, concurrently.
+// It returns the channels that failed.
+func notifyAll(
+	ctx context.Context,
+	settings map[string]*cache.Setting,
+	n *notification,
+	retry []string,
+	profile profileFunc,
+	accept func(login string, setting *cache.Setting) bool,
+) ([]string, error) {
+	return notifyClaimed(ctx, settings, n, retry, profile, accept, nil)
+}
+
+// notifyClaimed is notifyAll for the alerts claimed by `accept` before they are sent. The claims of the logins
+// that got nothing sent, because their channels are not retried, routed away or filtered out, or that have
+// failed channels, are given back by `release`, to be claimed again by the later stars or the retries.
+func notifyClaimed(
+	ctx context.Context,
+	settings map[string]*cache.Setting,
+	n *notification,
+	retry []string,
+	profile profileFunc,
+	accept func(login string, setting *cache.Setting) bool,
+	release func(login string),
+) ([]string, error) {
+	var mu sync.Mutex
+	var failed []string
+	wg := pool.New().WithContext(ctx).WithMaxGoroutines(10)
+	for login, setting := range settings {
+		if !accept(login, setting) {
+			continue
+		}
+		wg.Go(
+			func(ctx context.Context) error {
+				f, sent, err := sendNotify(ctx, n, login, setting, retry, profile)
+				if release != nil && (!sent || len(f) > 0) {
+					release(login)
+				}
+				mu.Lock()
+				failed = append(failed, f...)
+				mu.Unlock()
+				return err
+			},
+		)
+	}
+	err := wg.Wait()
+	return failed, err
+}
+
+// sendNotify sends the notification to the channels of the setting, only to the ones in `retry` if it's not nil.
+// Channels in digest mode accumulate the notification instead, so do the channels in quiet hours,
+// unless they can be sent silently or the notification is urgent.
+// Only the channels routed by the setting are considered.
+// It returns the channels that failed, and whether any channel is sent or has the notification in its digest.
+func sendNotify(
+	ctx context.Context,
+	n *notification,
+	login string,
+	setting *cache.Setting,
+	retry []string,
+	profile profileFunc,
+) ([]string, bool, error) {
+	now := time.Now()
+	quietUntil, quiet := setting.QuietUntil(now)
+	routed := setting.Route(n.kind, n.repoName(), n.sender.GetLogin(), profile)
+
+	var failed []string
+	var errs []error
+	var immediate, silent channelGroup
+	attempted := 0
+	for i, s := range setting.NotifySettings {
+		channel := channelID(login, i, s) + n.channelSuffix
+		if retry != nil && !lo.Contains(retry, channel) {
+			continue
+		}
+		if routed != nil && !lo.Contains(routed, i) {
+			continue
+		}
+		if !allowChannel(s, n, profile) {
+			continue
+		}
+		if n.urgent {
+			immediate.add(channel, s)
+			continue
+		}
+
+		var due time.Time
+		delivery, err := cache.ParseChannelDelivery(s, setting.Location())
+		switch {
+		case err == nil && delivery.IsDigest():
+			due = delivery.NextDigest(now)
+		case quiet && setting.IsSilent() && notify.SupportsSilent(s):
+			silent.add(channel, s)
+			continue
+		case quiet:
+			due = quietUntil
+		default:
+			immediate.add(channel, s)
+			continue
+		}
+
+		attempted++
+		err = cache.AddDigest(
+			ctx,
+			cache.DigestChannel{Account: n.account, Channel: channelID(login, i, s)},
+			due,
+			n.digestEntry(),
+		)
+		if err != nil {
+			failed = append(failed, channel)
+			errs = append(errs, fmt.Errorf("add digest: %w", err))
+		}
+	}
+
+	title, content := n.title, n.content
+	if setting.EnrichProfile && n.enrich != nil && len(immediate.channels)+len(silent.channels) > 0 {
+		p, err := profile()
+		if err != nil {
+			log.Printf("get profile of %s: %v", n.sender.GetLogin(), err)
+		} else {
+			title, content = n.enrich(p)
+			ctx = notify.WithTemplateData(ctx, map[string]any{"Sender": p})
+		}
+	}
+
+	for _, g := range []struct {
+		group  channelGroup
+		silent bool
+	}{{immediate, false}, {silent, true}} {
+		attempted += len(g.group.channels)
+		f, e := g.group.send(ctx, title, content, g.silent)
+		failed = append(failed, f...)
+		errs = append(errs, e...)
+	}
+
+	sent := attempted > len(failed)
+	err := errors.Join(errs...)
+	if err != nil {
+		return failed, sent, fmt.Errorf("send notify: %w", err)
+	}
+	return nil, sent, nil
+}
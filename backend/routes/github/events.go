@@ -0,0 +1,183 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// Events other than star are opt-in, see cache.Setting.Events.
+
+// sponsorshipPayload is the part of the `sponsorship` webhook that github.SponsorshipEvent lacks.
+type sponsorshipPayload struct {
+	Action      string `json:"action"`
+	Sponsorship struct {
+		Sponsor     *github.User `json:"sponsor"`
+		Sponsorable *github.User `json:"sponsorable"`
+		Tier        struct {
+			Name string `json:"name"`
+		} `json:"tier"`
+	} `json:"sponsorship"`
+	Changes struct {
+		Tier struct {
+			From struct {
+				Name string `json:"name"`
+			} `json:"from"`
+		} `json:"tier"`
+	} `json:"changes"`
+}
+
+func parseSponsorship(payload []byte) (*sponsorshipPayload, error) {
+	var p sponsorshipPayload
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// eventAccount returns the account whose settings receive the event, and false if the event is not interesting.
+func eventAccount(event any, payload []byte) (string, bool) {
+	switch evt := event.(type) {
+	case *github.StarEvent:
+		return evt.Repo.Owner.GetLogin(), true
+	case *github.ForkEvent:
+		return evt.Repo.Owner.GetLogin(), true
+	case *github.ReleaseEvent:
+		return evt.Repo.Owner.GetLogin(), evt.GetAction() == "published"
+	case *github.DiscussionEvent:
+		return evt.Repo.Owner.GetLogin(), evt.GetAction() == "created"
+	case *github.SponsorshipEvent:
+		p, err := parseSponsorship(payload)
+		if err != nil {
+			return "", false
+		}
+		switch p.Action {
+		case "created", "cancelled", "tier_changed":
+			return p.Sponsorship.Sponsorable.GetLogin(), true
+		}
+	}
+	return "", false
+}
+
+func link(text, url string) string {
+	return fmt.Sprintf("[%s](%s)", utils.EscapeMarkdown(text), utils.EscapeMarkdown(url))
+}
+
+// eventNotification composes the notification of an opt-in event.
+func eventNotification(event any, payload []byte) (*notification, error) {
+	n := &notification{}
+	switch evt := event.(type) {
+	case *github.ForkEvent:
+		n.kind = cache.RouteFork
+		n.account = evt.Repo.Owner.GetLogin()
+		n.repo, n.sender, n.installationID = evt.Repo, evt.Sender, evt.Installation.GetID()
+		n.title = fmt.Sprintf("New Fork of %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+		n.content = fmt.Sprintf(
+			"%s forked %s to %s, now it has **%d** forks\\.",
+			link(evt.Sender.GetLogin(), evt.Sender.GetHTMLURL()),
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
+			link(evt.Forkee.GetFullName(), evt.Forkee.GetHTMLURL()),
+			evt.Repo.GetForksCount(),
+		)
+	case *github.ReleaseEvent:
+		n.kind = cache.RouteRelease
+		n.account = evt.Repo.Owner.GetLogin()
+		n.repo, n.sender, n.installationID = evt.Repo, evt.Sender, evt.Installation.GetID()
+		name := evt.Release.GetName()
+		if name == "" {
+			name = evt.Release.GetTagName()
+		}
+		n.title = fmt.Sprintf("New Release of %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+		n.content = fmt.Sprintf(
+			"%s of %s was published by %s\\.",
+			link(name, evt.Release.GetHTMLURL()),
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
+			link(evt.Sender.GetLogin(), evt.Sender.GetHTMLURL()),
+		)
+	case *github.DiscussionEvent:
+		n.kind = cache.RouteDiscussion
+		n.account = evt.Repo.Owner.GetLogin()
+		n.repo, n.sender, n.installationID = evt.Repo, evt.Sender, evt.Installation.GetID()
+		n.title = fmt.Sprintf("New Discussion on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+		n.content = fmt.Sprintf(
+			"%s started %s in %s\\.",
+			link(evt.Sender.GetLogin(), evt.Sender.GetHTMLURL()),
+			link(evt.Discussion.GetTitle(), evt.Discussion.GetHTMLURL()),
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
+		)
+	case *github.SponsorshipEvent:
+		p, err := parseSponsorship(payload)
+		if err != nil {
+			return nil, err
+		}
+		sponsor, sponsorable := p.Sponsorship.Sponsor, p.Sponsorship.Sponsorable
+		n.kind = cache.RouteSponsorship
+		n.account = sponsorable.GetLogin()
+		n.sender, n.installationID = sponsor, evt.Installation.GetID()
+		switch p.Action {
+		case "created":
+			n.title = "New GitHub Sponsor"
+			n.content = fmt.Sprintf(
+				"%s started sponsoring %s with the **%s** tier\\.",
+				link(sponsor.GetLogin(), sponsor.GetHTMLURL()),
+				link(sponsorable.GetLogin(), sponsorable.GetHTMLURL()),
+				utils.EscapeMarkdown(p.Sponsorship.Tier.Name),
+			)
+		case "cancelled":
+			n.title = "Lost GitHub Sponsor"
+			n.content = fmt.Sprintf(
+				"%s cancelled the sponsorship of %s\\.",
+				link(sponsor.GetLogin(), sponsor.GetHTMLURL()),
+				link(sponsorable.GetLogin(), sponsorable.GetHTMLURL()),
+			)
+		default:
+			n.title = "GitHub Sponsorship Tier Changed"
+			n.content = fmt.Sprintf(
+				"%s changed the sponsorship of %s from **%s** to **%s**\\.",
+				link(sponsor.GetLogin(), sponsor.GetHTMLURL()),
+				link(sponsorable.GetLogin(), sponsorable.GetHTMLURL()),
+				utils.EscapeMarkdown(p.Changes.Tier.From.Name),
+				utils.EscapeMarkdown(p.Sponsorship.Tier.Name),
+			)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported event: %T", event)
+	}
+	return n, nil
+}
+
+// processEvent notifies an opt-in event to the settings of the account that opted in,
+// only to the channels in `retry` if it's not nil. It returns the channels that failed.
+func processEvent(ctx context.Context, event any, payload []byte, retry []string) ([]string, error) {
+	n, err := eventNotification(event, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := cache.GetAllSettings(ctx, n.account)
+	if err != nil {
+		return retry, fmt.Errorf("get all settings: %w", err)
+	}
+
+	profile := sync.OnceValues(
+		func() (cache.Profile, error) {
+			return cache.GetProfile(ctx, n.installationID, n.sender.GetLogin())
+		},
+	)
+
+	return notifyAll(
+		ctx, settings, n, retry, profile, func(login string, setting *cache.Setting) bool {
+			if !setting.WantsEvent(n.kind) {
+				return false
+			}
+			return n.repo == nil || setting.IsAllowRepo(repoInfo(n.repo))
+		},
+	)
+}
@@ -0,0 +1,84 @@
+package github
+
+import (
+	"log"
+	"time"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/condition"
+)
+
+// profileFunc returns the profile of the stargazer, it's fetched at most once per event.
+type profileFunc = func() (cache.Profile, error)
+
+// allowStargazer applies the stargazer filter of the setting, the profile is fetched only if needed.
+func allowStargazer(setting *cache.Setting, login string, profile profileFunc) bool {
+	if setting.StargazerFilter == nil {
+		return true
+	}
+	return setting.StargazerFilter.Match(login, profile)
+}
+
+func conditionEnv(n *notification, profile *cache.Profile) condition.Env {
+	env := condition.Env{
+		Action: n.kind,
+		Sender: condition.Sender{
+			Login: n.sender.GetLogin(),
+			Type:  n.sender.GetType(),
+		},
+	}
+	if n.repo != nil {
+		env.Repo = condition.Repo{
+			Name:     n.repo.GetName(),
+			FullName: n.repo.GetFullName(),
+			Owner:    n.repo.Owner.GetLogin(),
+			Stars:    n.repo.GetStargazersCount(),
+			Forks:    n.repo.GetForksCount(),
+			Language: n.repo.GetLanguage(),
+			Topics:   n.repo.Topics,
+			Fork:     n.repo.GetFork(),
+			Private:  n.repo.GetPrivate(),
+			Archived: n.repo.GetArchived(),
+		}
+	}
+	if profile != nil {
+		env.Sender.Name = profile.Name
+		env.Sender.Company = profile.Company
+		env.Sender.Location = profile.Location
+		env.Sender.Followers = profile.Followers
+		env.Sender.PublicRepos = profile.PublicRepos
+		env.Sender.AccountAgeDays = int(profile.AccountAge(time.Now()).Hours() / 24)
+	}
+	return env
+}
+
+// allowChannel evaluates the filter expression of the notify setting, channels without one receive everything.
+// Like the stargazer filter, the notification passes if the expression can't be evaluated.
+func allowChannel(ns map[string]string, n *notification, profile profileFunc) bool {
+	src := ns["filter"]
+	if src == "" {
+		return true
+	}
+	program, err := condition.Compile(src)
+	if err != nil {
+		log.Printf("compile filter %q: %v", src, err)
+		return true
+	}
+
+	var p *cache.Profile
+	if program.UsesProfile() {
+		v, err := profile()
+		if err != nil {
+			log.Printf("get profile of %s: %v", n.sender.GetLogin(), err)
+			return true
+		}
+		p = &v
+	}
+
+	ok, err := program.Eval(conditionEnv(n, p))
+	if err != nil {
+		log.Printf("eval filter %q: %v", src, err)
+		return true
+	}
+	return ok
+}
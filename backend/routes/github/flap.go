@@ -0,0 +1,128 @@
+package github
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+// debouncer decides whether the settings with a debounce window are notified of a star event now.
+// It fails open: the events are notified right away if the flapping state can't be recorded.
+type debouncer struct {
+	repo   string
+	sender string
+	action string
+	now    time.Time
+	// the window of the held job, 0 if the job is the live event
+	window time.Duration
+	// retrying the failed channels of the live event
+	retry bool
+	// stars of the sender on the repo in the last day
+	stars int64
+	flap  *cache.Flap
+	// the windows (in seconds) that the event is held for
+	held map[int]bool
+}
+
+func newDebouncer(
+	ctx context.Context,
+	evt *github.StarEvent,
+	job *cache.OutboxJob,
+	settings map[string]*cache.Setting,
+) *debouncer {
+	d := &debouncer{
+		repo:   evt.Repo.GetFullName(),
+		sender: evt.Sender.GetLogin(),
+		action: evt.GetAction(),
+		now:    time.Now(),
+		window: time.Duration(job.Debounce) * time.Second,
+		retry:  job.Retry != nil,
+		held:   make(map[int]bool),
+	}
+
+	var windows []int
+	for _, setting := range settings {
+		if setting.Debounce > 0 {
+			windows = append(windows, setting.Debounce)
+		}
+	}
+	windows = lo.Uniq(windows)
+	if len(windows) == 0 {
+		return d
+	}
+
+	repo, sender := evt.Repo.GetFullName(), evt.Sender.GetLogin()
+	var err error
+	switch {
+	case d.window > 0:
+		d.flap, err = cache.GetFlap(ctx, repo, sender)
+	case d.retry:
+		// the settings with a debounce window either were held, or have failed channels to retry
+	case d.action == "created":
+		d.stars, err = cache.RecordStar(ctx, repo, sender, d.now)
+		if err != nil || d.stars > 1 {
+			break
+		}
+		for _, w := range windows {
+			held := *job
+			held.Debounce = w
+			held.Retry = nil
+			if err := cache.ScheduleRetry(ctx, held, d.now.Add(time.Duration(w)*time.Second)); err != nil {
+				log.Printf("debounce: hold %s for %ds: %v", job.DeliveryID, w, err)
+				// sent right away, so is its unstar
+				_, _ = cache.DecideFlap(ctx, repo, sender, d.now.Unix(), time.Duration(w)*time.Second, cache.FlapStar)
+				continue
+			}
+			d.held[w] = true
+		}
+	case d.action == "deleted":
+		d.flap, d.stars, err = cache.RecordUnstar(ctx, repo, sender, d.now)
+	}
+	if err != nil {
+		log.Printf("debounce: %s starred by %s: %v", repo, sender, err)
+	}
+	return d
+}
+
+// decide settles the held star of the window and its unstar, returns the winning decision.
+// It fails open: the star is taken as sent if the decision can't be made.
+func (d *debouncer) decide(ctx context.Context, window time.Duration, decision string) string {
+	if d.flap == nil {
+		return cache.FlapStar
+	}
+	winner, err := cache.DecideFlap(ctx, d.repo, d.sender, d.flap.StarredAt, window, decision)
+	if err != nil {
+		log.Printf("debounce: decide %s starred by %s: %v", d.repo, d.sender, err)
+		return cache.FlapStar
+	}
+	return winner
+}
+
+// accept reports whether the setting is notified of the event by this job. It's called right before sending,
+// so a held star is dropped if its unstar has come since, even after the window.
+func (d *debouncer) accept(ctx context.Context, setting *cache.Setting) bool {
+	w := setting.DebounceWindow()
+	if d.window > 0 {
+		return w == d.window && d.decide(ctx, w, cache.FlapStar) == cache.FlapStar
+	}
+	if w == 0 || d.retry {
+		return true
+	}
+	// restars and their unstars are ignored
+	if d.stars > 1 {
+		return false
+	}
+	switch d.action {
+	case "created":
+		return !d.held[setting.Debounce]
+	case "deleted":
+		// notified only if the held star has been sent, otherwise both are dropped
+		return d.decide(ctx, w, cache.FlapUnstar) == cache.FlapStar
+	}
+	return true
+}
@@ -1,45 +1,97 @@
 package github
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/go-github/v84/github"
-	"github.com/sourcegraph/conc/pool"
+	"github.com/samber/lo"
 
 	"github.com/j178/github_stargazer/backend/cache"
 	"github.com/j178/github_stargazer/backend/config"
-	"github.com/j178/github_stargazer/backend/notify"
 	"github.com/j178/github_stargazer/backend/routes"
 	"github.com/j178/github_stargazer/backend/utils"
 )
 
-func compose(evt *github.StarEvent) (string, string) {
+// stargazerText is the link to the stargazer, followed by the profile details if it's given,
+// e.g. "Linus Torvalds (@torvalds, 200k followers, Linux Foundation)".
+func stargazerText(user *github.User, p *cache.Profile) string {
+	if p == nil {
+		return link(user.GetLogin(), user.GetHTMLURL())
+	}
+	details := []string{"@" + p.Login, utils.FormatCompact(p.Followers) + " followers"}
+	if p.Company != "" {
+		details = append(details, p.Company)
+	}
+	return fmt.Sprintf(
+		"%s \\(%s\\)",
+		link(cmp.Or(p.Name, p.Login), cmp.Or(p.HTMLURL, user.GetHTMLURL())),
+		utils.EscapeMarkdown(strings.Join(details, ", ")),
+	)
+}
+
+// profileLines are the lines appended to the messages to introduce the stargazer.
+func profileLines(p *cache.Profile) string {
+	var lines []string
+	if p.Bio != "" {
+		lines = append(lines, "_"+utils.EscapeMarkdown(p.Bio)+"_")
+	}
+
+	var facts []string
+	if p.Location != "" {
+		facts = append(facts, utils.EscapeMarkdown(p.Location))
+	}
+	facts = append(facts, utils.EscapeMarkdown(fmt.Sprintf("%s public repos", utils.FormatNumber(p.PublicRepos))))
+	if p.CreatedAt > 0 {
+		facts = append(facts, fmt.Sprintf("joined %d", time.Unix(p.CreatedAt, 0).Year()))
+	}
+	if p.Blog != "" {
+		blog := p.Blog
+		if !strings.Contains(blog, "://") {
+			blog = "https://" + blog
+		}
+		facts = append(facts, link(p.Blog, blog))
+	}
+	if p.Twitter != "" {
+		facts = append(facts, link("@"+p.Twitter, "https://twitter.com/"+p.Twitter))
+	}
+	lines = append(lines, strings.Join(facts, " · "))
+	return strings.Join(lines, "\n")
+}
+
+// compose returns the title and content of the star event, the profile of the stargazer is introduced if it's given.
+func compose(evt *github.StarEvent, p *cache.Profile) (string, string) {
 	var title, text string
 	switch evt.GetAction() {
 	case "deleted":
 		title = fmt.Sprintf("Lost GitHub Star on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
 		text = fmt.Sprintf(
-			"[%s](%s) unstarred [%s](%s), now it has **%d** stars\\.",
-			utils.EscapeMarkdown(evt.Sender.GetLogin()),
-			utils.EscapeMarkdown(evt.Sender.GetHTMLURL()),
-			utils.EscapeMarkdown(evt.Repo.GetFullName()),
-			utils.EscapeMarkdown(evt.Repo.GetHTMLURL()),
+			"%s unstarred %s, now it has **%d** stars\\.",
+			stargazerText(evt.Sender, p),
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
 			evt.Repo.GetStargazersCount(),
 		)
 	case "created":
 		title = fmt.Sprintf("New GitHub Star on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
 		text = fmt.Sprintf(
-			"[%s](%s) starred [%s](%s), now it has **%d** stars\\.",
-			utils.EscapeMarkdown(evt.Sender.GetLogin()),
-			utils.EscapeMarkdown(evt.Sender.GetHTMLURL()),
-			utils.EscapeMarkdown(evt.Repo.GetFullName()),
-			utils.EscapeMarkdown(evt.Repo.GetHTMLURL()),
+			"%s starred %s, now it has **%d** stars\\.",
+			stargazerText(evt.Sender, p),
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
 			evt.Repo.GetStargazersCount(),
 		)
 	}
+	if p != nil && text != "" {
+		text += "\n\n" + profileLines(p)
+	}
 	return title, text
 }
 
@@ -57,56 +109,176 @@ func OnEvent(c *gin.Context) {
 		return
 	}
 
-	switch webhookType {
-	case "star":
-		evt, _ := event.(*github.StarEvent)
-		settings, err := cache.GetAllSettings(c, evt.Repo.Owner.GetLogin())
+	ok, err := onLifecycle(c, event)
+	if ok {
 		if err != nil {
-			routes.Abort(c, http.StatusInternalServerError, err, "get all settings")
-			return
-		}
-		if len(settings) == 0 {
-			c.String(http.StatusOK, "Settings not found")
+			routes.Abort(c, http.StatusInternalServerError, err, "handle lifecycle event")
 			return
 		}
+		c.String(http.StatusOK, "OK")
+		return
+	}
 
-		wg := pool.New().WithContext(c).WithMaxGoroutines(10)
-		for _, setting := range settings {
-			setting := setting
-			if evt.GetAction() == "deleted" && setting.MuteLostStars {
-				continue
-			}
-			if !setting.IsAllowRepo(evt.Repo.GetFullName()) {
-				continue
-			}
-			wg.Go(
-				func(ctx context.Context) error {
-					return sendNotify(ctx, evt, setting)
-				},
-			)
-		}
-		err = wg.Wait()
-		if err != nil {
-			routes.Abort(c, http.StatusInternalServerError, err, "notify")
-			return
+	account, ok := eventAccount(event, payload)
+	if !ok {
+		c.String(http.StatusOK, "Not interested event")
+		return
+	}
+
+	deliveryID := github.DeliveryID(c.Request)
+	prev, ok, err := cache.BeginDelivery(c, deliveryID)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, "begin delivery")
+		return
+	}
+	if !ok {
+		c.String(http.StatusOK, "Duplicate delivery")
+		return
+	}
+
+	job := cache.OutboxJob{
+		DeliveryID: deliveryID,
+		Event:      webhookType,
+		Payload:    payload,
+		Account:    account,
+		EnqueuedAt: time.Now().Unix(),
+	}
+	if prev != nil {
+		job.Retry = prev.Failed
+		// redelivered manually, the dead letters of its jobs are replayed by this delivery
+		if err := cache.RemoveDeliveryDeadLetters(c, account, deliveryID); err != nil {
+			log.Printf("remove dead letters of %s: %v", deliveryID, err)
 		}
+	}
 
-	default:
-		c.String(http.StatusOK, "Not interested event")
+	err = cache.Enqueue(c, job)
+	if err != nil {
+		_ = cache.AbortDelivery(c, deliveryID)
+		routes.Abort(c, http.StatusInternalServerError, err, "enqueue")
+		return
+	}
+	if err = cache.QueueDelivery(c, deliveryID); err != nil {
+		log.Printf("queue delivery %s: %v", deliveryID, err)
+	}
+
+	runDueTasks(c)
+	c.String(http.StatusAccepted, "Queued")
+}
+
+func repoInfo(repo *github.Repository) cache.RepoInfo {
+	return cache.RepoInfo{
+		FullName: repo.GetFullName(),
+		Fork:     repo.GetFork(),
+		Archived: repo.GetArchived(),
+		Private:  repo.GetPrivate(),
 	}
 }
 
-func sendNotify(ctx context.Context, evt *github.StarEvent, setting *cache.Setting) error {
-	notifier, err := notify.GetNotifier(setting.NotifySettings)
+// starAccount returns the account whose settings the star event is notified to. It's the repo owner,
+// or the account of the watchers for the events of the polled repos, see Poll.
+func starAccount(evt *github.StarEvent) string {
+	if login := evt.Installation.GetAccount().GetLogin(); login != "" {
+		return login
+	}
+	return evt.Repo.Owner.GetLogin()
+}
+
+func starNotification(evt *github.StarEvent) *notification {
+	title, content := compose(evt, nil)
+	return &notification{
+		kind:           evt.GetAction(),
+		account:        starAccount(evt),
+		repo:           evt.Repo,
+		sender:         evt.Sender,
+		installationID: evt.Installation.GetID(),
+		title:          title,
+		content:        content,
+		enrich: func(p cache.Profile) (string, string) {
+			return compose(evt, &p)
+		},
+	}
+}
+
+// recordStar appends the event to the star history of the repo, and counts the star rate of the repo.
+func recordStar(ctx context.Context, evt *github.StarEvent, job *cache.OutboxJob) {
+	at := job.EnqueuedAt
+	if evt.StarredAt != nil {
+		at = evt.StarredAt.Unix()
+	}
+	err := cache.AddStarRecord(
+		ctx, evt.Repo.GetFullName(), cache.StarRecord{
+			Action: evt.GetAction(),
+			Sender: evt.Sender.GetLogin(),
+			Stars:  evt.Repo.GetStargazersCount(),
+			At:     at,
+		},
+	)
 	if err != nil {
-		return err
+		log.Printf("record star of %s: %v", evt.Repo.GetFullName(), err)
+	}
+	if evt.GetAction() == "created" {
+		if err := cache.CountStar(ctx, evt.Repo.GetFullName(), time.Unix(at, 0)); err != nil {
+			log.Printf("count star of %s: %v", evt.Repo.GetFullName(), err)
+		}
 	}
+}
 
-	title, content := compose(evt)
+// processStar notifies the star event to all settings of the repo owner, only to the channels in `job.Retry` if it's not nil.
+// It returns the channels that failed.
+func processStar(ctx context.Context, evt *github.StarEvent, job *cache.OutboxJob) ([]string, error) {
+	retry := job.Retry
+	// recorded by the first attempt, the flag is kept in the retries and the held jobs
+	if !job.Recorded && job.Debounce == 0 {
+		recordStar(ctx, evt, job)
+		job.Recorded = true
+	}
 
-	err = notifier.Send(ctx, title, content)
+	account := starAccount(evt)
+	settings, err := cache.GetAllSettings(ctx, account)
 	if err != nil {
-		return err
+		return retry, fmt.Errorf("get all settings: %w", err)
 	}
-	return nil
+	// polled for the members watching it, who can read the repo, even if the account owns the repo
+	if isPolled(job) {
+		settings = lo.PickBy(
+			settings, func(login string, s *cache.Setting) bool {
+				// the jobs enqueued without the watchers are notified to all of them
+				return s.IsWatchRepo(evt.Repo.GetFullName()) &&
+					(job.Watchers == nil || slices.Contains(job.Watchers, login))
+			},
+		)
+	}
+
+	profile := sync.OnceValues(
+		func() (cache.Profile, error) {
+			return cache.GetProfile(ctx, evt.Installation.GetID(), evt.Sender.GetLogin())
+		},
+	)
+
+	// the settings with a debounce window are notified by the held jobs, together with the alerts
+	debounce := newDebouncer(ctx, evt, job, settings)
+	settings = lo.PickBy(
+		settings, func(_ string, s *cache.Setting) bool {
+			return debounce.accept(ctx, s)
+		},
+	)
+	notable := notableStargazers(ctx, evt, settings, profile)
+	failed, err := notifyAll(
+		ctx, settings, starNotification(evt), retry, profile, func(login string, setting *cache.Setting) bool {
+			if evt.GetAction() == "deleted" && setting.MuteLostStars {
+				return false
+			}
+			// alerted as notable instead
+			if notable[login] != "" {
+				return false
+			}
+			return setting.IsAllowRepo(repoInfo(evt.Repo)) && allowStargazer(setting, evt.Sender.GetLogin(), profile)
+		},
+	)
+	nfailed, nerr := sendNotables(ctx, evt, settings, notable, retry, profile)
+	mfailed, merr := sendMilestones(ctx, evt, settings, retry, profile)
+	sfailed, serr := sendSpikes(ctx, evt, settings, retry, profile)
+	xfailed, xerr := sendSuspicion(ctx, evt, settings, retry, profile)
+
+	return slices.Concat(failed, nfailed, mfailed, sfailed, xfailed), errors.Join(err, nerr, merr, serr, xerr)
 }
@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/config"
+	"github.com/j178/github_stargazer/backend/notify"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// onLifecycle keeps the caches, settings and tokens consistent with the installation lifecycle events.
+// It returns false if the event is not a lifecycle event.
+func onLifecycle(ctx context.Context, event any) (bool, error) {
+	switch evt := event.(type) {
+	case *github.InstallationEvent:
+		return true, onInstallation(ctx, evt)
+	case *github.InstallationRepositoriesEvent:
+		errs := []error{
+			cache.Delete(ctx, cache.InstallationReposKey(evt.Installation.GetID())),
+			cache.ForgetRepoInstallation(ctx, repoNames(slices.Concat(evt.RepositoriesAdded, evt.RepositoriesRemoved))...),
+		}
+		if len(evt.RepositoriesAdded) > 0 {
+			errs = append(errs, cache.QueueBackfill(ctx, evt.Installation.GetID()))
+		}
+		return true, errors.Join(errs...)
+	case *github.GitHubAppAuthorizationEvent:
+		if evt.GetAction() != "revoked" {
+			return true, nil
+		}
+		login := evt.Sender.GetLogin()
+		return true, errors.Join(
+			cache.DeleteOAuthToken(ctx, login),
+			cache.Delete(ctx, cache.InstallationsKey(login)),
+		)
+	}
+	return false, nil
+}
+
+func onInstallation(ctx context.Context, evt *github.InstallationEvent) error {
+	installationID := evt.Installation.GetID()
+	account := evt.Installation.Account.GetLogin()
+
+	// the installations of other members are refreshed when they expire
+	errs := []error{
+		cache.Delete(ctx, cache.InstallationReposKey(installationID)),
+		cache.Delete(ctx, cache.InstallationsKey(evt.Sender.GetLogin())),
+		cache.Delete(ctx, cache.InstallationsKey(account)),
+		cache.ForgetRepoInstallation(ctx, repoNames(evt.Repositories)...),
+	}
+
+	switch evt.GetAction() {
+	case "created":
+		restored, err := cache.RestoreSettings(ctx, account)
+		if restored {
+			log.Printf("installation: restored settings of %s", account)
+			err = errors.Join(err, rescheduleSettings(ctx, account))
+		}
+		errs = append(errs, err, cache.QueueBackfill(ctx, installationID))
+	case "deleted":
+		errs = append(
+			errs,
+			cache.FinishBackfill(ctx, installationID),
+			cache.DeleteInstallationToken(ctx, installationID),
+			uninstall(ctx, evt),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+func repoNames(repos []*github.Repository) []string {
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = repo.GetFullName()
+	}
+	return names
+}
+
+// rescheduleSettings schedules the reports and the polling of the restored settings again.
+func rescheduleSettings(ctx context.Context, account string) error {
+	settings, err := cache.GetAllSettings(ctx, account)
+	if err != nil {
+		return fmt.Errorf("get all settings: %w", err)
+	}
+	var errs []error
+	for login, setting := range settings {
+		errs = append(errs, cache.ScheduleSetting(ctx, account, login, setting, time.Now()))
+	}
+	return errors.Join(errs...)
+}
+
+func composeUninstall(evt *github.InstallationEvent) (string, string) {
+	account := evt.Installation.Account
+	title := fmt.Sprintf("GitHub Stargazer removed from %s", utils.EscapeMarkdown(account.GetLogin()))
+	text := fmt.Sprintf(
+		"[%s](%s) uninstalled the app from [%s](%s), no more notifications will be sent\\.",
+		utils.EscapeMarkdown(evt.Sender.GetLogin()),
+		utils.EscapeMarkdown(evt.Sender.GetHTMLURL()),
+		utils.EscapeMarkdown(account.GetLogin()),
+		utils.EscapeMarkdown(account.GetHTMLURL()),
+	)
+	if config.UninstallSettings != "delete" {
+		text += utils.EscapeMarkdown(
+			fmt.Sprintf(
+				" The settings are kept for %d days in case it's installed again.",
+				int(cache.ArchivedSettingsExpire.Hours()/24),
+			),
+		)
+	}
+	return title, text
+}
+
+// uninstall notifies the settings that asked for it, then archives or deletes all settings of the account.
+func uninstall(ctx context.Context, evt *github.InstallationEvent) error {
+	account := evt.Installation.Account.GetLogin()
+	settings, err := cache.GetAllSettings(ctx, account)
+	if err != nil {
+		return fmt.Errorf("get all settings: %w", err)
+	}
+
+	title, content := composeUninstall(evt)
+	for login, setting := range settings {
+		if setting.NotifyUninstall {
+			notifier, err := notify.GetNotifier(setting.NotifySettings)
+			if err == nil {
+				err = notifier.Send(ctx, title, content)
+			}
+			if err != nil {
+				log.Printf("installation: notify uninstall of %s to %s: %v", account, login, err)
+			}
+		}
+		notify.Invalidate(setting.NotifySettings)
+		if err := cache.UnscheduleSetting(ctx, account, login); err != nil {
+			log.Printf("installation: unschedule %s of %s: %v", login, account, err)
+		}
+	}
+
+	if config.UninstallSettings == "delete" {
+		err = cache.DeleteAllSettings(ctx, account)
+	} else {
+		err = cache.ArchiveSettings(ctx, account)
+	}
+	if err != nil {
+		return fmt.Errorf("%s settings: %w", config.UninstallSettings, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// appended to the channel IDs of milestone notifications
+const milestoneSuffix = "/milestone"
+
+func composeMilestone(evt *github.StarEvent, milestone int) (string, string) {
+	stars := utils.FormatNumber(milestone)
+	title := fmt.Sprintf("🎉 %s reached %s stars", utils.EscapeMarkdown(evt.Repo.GetFullName()), utils.EscapeMarkdown(stars))
+	text := fmt.Sprintf(
+		"[%s](%s) just reached **%s** stars, thanks to [%s](%s)\\!",
+		utils.EscapeMarkdown(evt.Repo.GetFullName()),
+		utils.EscapeMarkdown(evt.Repo.GetHTMLURL()),
+		utils.EscapeMarkdown(stars),
+		utils.EscapeMarkdown(evt.Sender.GetLogin()),
+		utils.EscapeMarkdown(evt.Sender.GetHTMLURL()),
+	)
+	return title, text
+}
+
+// claimedMilestone is a milestone claimed for a login, with the last one before it.
+type claimedMilestone struct {
+	milestone int
+	last      int
+}
+
+// sendMilestones notifies the settings whose milestone rule has been passed by the star count of the event.
+// Each milestone is notified only once per repo and login, it returns the channels that failed.
+func sendMilestones(
+	ctx context.Context,
+	evt *github.StarEvent,
+	settings map[string]*cache.Setting,
+	retry []string,
+	profile profileFunc,
+) ([]string, error) {
+	if evt.GetAction() != "created" {
+		return nil, nil
+	}
+
+	// the settings that reached the same milestone share the message
+	repo := evt.Repo.GetFullName()
+	claimed := make(map[string]claimedMilestone)
+	byMilestone := make(map[int]map[string]*cache.Setting)
+	for login, setting := range settings {
+		if setting.Milestones == nil {
+			continue
+		}
+		if !setting.IsAllowRepo(repoInfo(evt.Repo)) || !allowStargazer(setting, evt.Sender.GetLogin(), profile) {
+			continue
+		}
+		m, last, err := cache.ClaimMilestone(ctx, setting.Milestones, repo, login, evt.Repo.GetStargazersCount())
+		if err != nil {
+			log.Printf("claim milestone of %s: %v", repo, err)
+			continue
+		}
+		if m == 0 {
+			continue
+		}
+		claimed[login] = claimedMilestone{milestone: m, last: last}
+		if byMilestone[m] == nil {
+			byMilestone[m] = make(map[string]*cache.Setting)
+		}
+		byMilestone[m][login] = setting
+	}
+
+	var failed []string
+	var errs []error
+	for m, group := range byMilestone {
+		title, content := composeMilestone(evt, m)
+		n := &notification{
+			kind:           cache.RouteMilestone,
+			account:        starAccount(evt),
+			repo:           evt.Repo,
+			sender:         evt.Sender,
+			installationID: evt.Installation.GetID(),
+			title:          title,
+			content:        content,
+			channelSuffix:  milestoneSuffix,
+		}
+		f, err := notifyClaimed(
+			ctx, group, n, retry, profile, func(string, *cache.Setting) bool {
+				return true
+			}, func(login string) {
+				c := claimed[login]
+				_ = cache.ReleaseMilestone(ctx, repo, login, c.milestone, c.last)
+			},
+		)
+		failed = append(failed, f...)
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return failed, fmt.Errorf("send milestone: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,117 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// appended to the channel IDs of notable stargazer alerts
+const notableSuffix = "/notable"
+
+// notableStargazers returns why the stargazer of the event is notable to each login, the ones not notable are absent.
+func notableStargazers(
+	ctx context.Context,
+	evt *github.StarEvent,
+	settings map[string]*cache.Setting,
+	profile profileFunc,
+) map[string]string {
+	reasons := make(map[string]string)
+	if evt.GetAction() != "created" {
+		return reasons
+	}
+
+	login := evt.Sender.GetLogin()
+	orgs := sync.OnceValues(
+		func() ([]string, error) {
+			return cache.GetOrgs(ctx, evt.Installation.GetID(), login)
+		},
+	)
+	for l, setting := range settings {
+		// alerted even if the regular stars of the repo are muted
+		if !setting.Notable.AllowRepo(evt.Repo.GetFullName()) {
+			continue
+		}
+		if reason := setting.Notable.Match(login, profile, orgs); reason != "" {
+			reasons[l] = reason
+		}
+	}
+	return reasons
+}
+
+func composeNotable(evt *github.StarEvent, p *cache.Profile, reason string) (string, string) {
+	title := fmt.Sprintf("🌟 Notable Stargazer on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+	_, text := compose(evt, p)
+	return title, fmt.Sprintf("**Notable**: %s\n\n%s", utils.EscapeMarkdown(reason), text)
+}
+
+// sendNotables alerts the settings that the stargazer is notable to, in place of the regular star notification.
+// It returns the channels that failed.
+func sendNotables(
+	ctx context.Context,
+	evt *github.StarEvent,
+	settings map[string]*cache.Setting,
+	reasons map[string]string,
+	retry []string,
+	profile profileFunc,
+) ([]string, error) {
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+
+	var p *cache.Profile
+	if v, err := profile(); err == nil {
+		p = &v
+	}
+
+	// the message tells the reason, which differs between the settings
+	byReason := make(map[string]map[string]*cache.Setting)
+	for login, reason := range reasons {
+		if byReason[reason] == nil {
+			byReason[reason] = make(map[string]*cache.Setting)
+		}
+		byReason[reason][login] = settings[login]
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	wg := pool.New().WithErrors().WithContext(ctx)
+	for reason, group := range byReason {
+		title, content := composeNotable(evt, p, reason)
+		n := &notification{
+			kind:           cache.RouteNotable,
+			account:        starAccount(evt),
+			repo:           evt.Repo,
+			sender:         evt.Sender,
+			installationID: evt.Installation.GetID(),
+			title:          title,
+			content:        content,
+			urgent:         true,
+			channelSuffix:  notableSuffix,
+		}
+		wg.Go(
+			func(ctx context.Context) error {
+				f, err := notifyAll(
+					ctx, group, n, retry, profile, func(string, *cache.Setting) bool {
+						return true
+					},
+				)
+				mu.Lock()
+				failed = append(failed, f...)
+				mu.Unlock()
+				return err
+			},
+		)
+	}
+	err := wg.Wait()
+	if err != nil {
+		return failed, fmt.Errorf("send notable: %w", err)
+	}
+	return nil, nil
+}
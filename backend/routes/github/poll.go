@@ -0,0 +1,348 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+const (
+	pollPerPage = 100
+	// pages of the latest stargazers fetched at most in one poll
+	pollMaxPages = 3
+	// GitHub doesn't page beyond 40,000 stargazers
+	stargazersPageLimit = 40000 / pollPerPage
+)
+
+// pollDeliveryPrefix is the prefix of the delivery IDs of the polled stars, the other ones are from GitHub.
+const pollDeliveryPrefix = "poll-"
+
+// isPolled reports whether the job is a star found by Poll.
+func isPolled(job *cache.OutboxJob) bool {
+	return job.Watchers != nil || strings.HasPrefix(job.DeliveryID, pollDeliveryPrefix)
+}
+
+// errStargazersLimit means the latest stargazers of the repo can't be listed, only its star count is known.
+var errStargazersLimit = errors.New("too many stargazers to list")
+
+// watcher is a setting watching a repo, with the installation of the app on its account.
+type watcher struct {
+	cache.Watcher
+	installationID int64
+	client         *github.Client
+}
+
+// poller polls the watched repos with the OAuth tokens of the watchers.
+type poller struct {
+	now func() time.Time
+	// the installations of the accounts listed with the OAuth tokens of the logins
+	installations map[string][]*github.Installation
+}
+
+// newWatcher returns nil if the login can't poll for the account anymore, the app is uninstalled or the token is revoked.
+func (p *poller) newWatcher(ctx context.Context, t cache.Watcher) (*watcher, error) {
+	token, err := cache.GetOAuthToken(ctx, t.Login)
+	if err != nil {
+		return nil, fmt.Errorf("get oauth token: %w", err)
+	}
+	client := github.NewClient(nil).WithAuthToken(token)
+
+	installations, ok := p.installations[t.Login]
+	if !ok {
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			list, resp, err := client.Apps.ListUserInstallations(ctx, opts)
+			if err != nil {
+				return nil, checkRate(resp, err)
+			}
+			installations = append(installations, list...)
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+		p.installations[t.Login] = installations
+	}
+	for _, installation := range installations {
+		if installation.Account.GetLogin() == t.Account {
+			return &watcher{Watcher: t, installationID: installation.GetID(), client: client}, nil
+		}
+	}
+	return nil, nil
+}
+
+// latestStargazers pages back from the last page of the stargazers, until the ones starred before `after`.
+// It returns the stargazers after `after`, the oldest first.
+func latestStargazers(ctx context.Context, client *github.Client, repo *github.Repository, after int64) (
+	[]*github.Stargazer,
+	error,
+) {
+	var stargazers []*github.Stargazer
+	last := (repo.GetStargazersCount() + pollPerPage - 1) / pollPerPage
+	if last > stargazersPageLimit {
+		return nil, errStargazersLimit
+	}
+	for page := last; page >= 1 && page > last-pollMaxPages; page-- {
+		list, resp, err := client.Activity.ListStargazers(
+			ctx,
+			repo.Owner.GetLogin(),
+			repo.GetName(),
+			&github.ListOptions{Page: page, PerPage: pollPerPage},
+		)
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusUnprocessableEntity {
+			return nil, errStargazersLimit
+		}
+		if err != nil {
+			return nil, checkRate(resp, err)
+		}
+		done := false
+		for i := len(list) - 1; i >= 0; i-- {
+			if list[i].GetStarredAt().Unix() <= after {
+				done = true
+				break
+			}
+			stargazers = append(stargazers, list[i])
+		}
+		if done {
+			break
+		}
+	}
+	slices.Reverse(stargazers)
+	return stargazers, nil
+}
+
+// pollRepo fetches the repo with its ETag, and the new stargazers if the repo has changed.
+// The first poll of a repo only remembers its state. Unstars are not known without the full list of stargazers.
+// The repos with too many stargazers to list only keep their star counts.
+func (p *poller) pollRepo(ctx context.Context, client *github.Client, name string) (
+	*github.Repository,
+	[]*github.Stargazer,
+	error,
+) {
+	state, err := cache.GetPollState(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get poll state: %w", err)
+	}
+
+	req, err := client.NewRequest(http.MethodGet, "repos/"+name, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	var repo github.Repository
+	resp, err := client.Do(ctx, req, &repo)
+	// conditional requests don't count against the rate limit
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, checkRate(resp, err)
+	}
+
+	firstPoll := state.ETag == "" && state.LastStarredAt == 0
+	var stargazers []*github.Stargazer
+	// a star and an unstar keep the count, the newest stargazers tell the new stars
+	if !firstPoll {
+		stargazers, err = latestStargazers(ctx, client, &repo, state.LastStarredAt)
+		if errors.Is(err, errStargazersLimit) {
+			log.Printf("poll: %s stars %d -> %d: %v", name, state.Stars, repo.GetStargazersCount(), err)
+			err = nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	state.ETag = resp.Header.Get("ETag")
+	state.Stars = repo.GetStargazersCount()
+	if firstPoll {
+		state.LastStarredAt = p.now().Unix()
+	}
+	if len(stargazers) > 0 {
+		state.LastStarredAt = stargazers[len(stargazers)-1].GetStarredAt().Unix()
+	}
+	if err := cache.SavePollState(ctx, name, state); err != nil {
+		return nil, nil, fmt.Errorf("save poll state: %w", err)
+	}
+	return &repo, stargazers, nil
+}
+
+// canRead reports whether the watcher can read the repo with its own token, the public repos can be read by anyone.
+func (p *poller) canRead(ctx context.Context, w *watcher, repo *github.Repository) bool {
+	if !repo.GetPrivate() {
+		return true
+	}
+	ok, err := cache.CanReadRepo(
+		ctx, repo.GetFullName(), w.Login, func() (bool, error) {
+			_, resp, err := w.client.Repositories.Get(ctx, repo.Owner.GetLogin(), repo.GetName())
+			if err = checkRate(resp, err); err != nil {
+				var errResp *github.ErrorResponse
+				if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+					return false, nil
+				}
+				return false, err
+			}
+			return true, nil
+		},
+	)
+	if err != nil {
+		log.Printf("poll: check access of %s to %s: %v", w.Login, repo.GetFullName(), err)
+	}
+	return ok
+}
+
+// enqueueStar feeds a synthetic star event of the polled repo to the outbox, as if it's delivered by the webhook.
+// The account of the installation tells processStar to notify the settings of the watchers instead of the repo owner.
+func enqueueStar(ctx context.Context, w *watcher, logins []string, repo github.Repository, s *github.Stargazer) error {
+	evt := github.StarEvent{
+		Action:    github.Ptr("created"),
+		StarredAt: s.StarredAt,
+		Repo:      &repo,
+		Sender:    s.User,
+		Installation: &github.Installation{
+			ID:      github.Ptr(w.installationID),
+			Account: &github.User{Login: github.Ptr(w.Account)},
+		},
+	}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	deliveryID := fmt.Sprintf(
+		"%s%s-%s-%s-%d", pollDeliveryPrefix, w.Account, repo.GetFullName(), s.User.GetLogin(), s.GetStarredAt().Unix(),
+	)
+	_, ok, err := cache.BeginDelivery(ctx, deliveryID)
+	if err != nil || !ok {
+		return err
+	}
+	job := cache.OutboxJob{
+		DeliveryID: deliveryID,
+		Event:      "star",
+		Payload:    payload,
+		Account:    w.Account,
+		EnqueuedAt: time.Now().Unix(),
+		Watchers:   logins,
+		Recorded:   true,
+	}
+	if err := cache.Enqueue(ctx, job); err != nil {
+		_ = cache.AbortDelivery(ctx, deliveryID)
+		return err
+	}
+	return cache.QueueDelivery(ctx, deliveryID)
+}
+
+// watchers returns the settings watching each repo, and drops the ones not watching anything anymore.
+func (p *poller) watchers(ctx context.Context) (map[string][]*watcher, error) {
+	targets, err := cache.Watchers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get watchers: %w", err)
+	}
+
+	repos := make(map[string][]*watcher)
+	for _, t := range targets {
+		setting, err := cache.GetSettings(ctx, t.Account, t.Login)
+		if err != nil {
+			log.Printf("poll: get settings of %s of %s: %v", t.Login, t.Account, err)
+			continue
+		}
+		if setting == nil || len(setting.WatchRepos) == 0 {
+			_ = cache.RemoveWatcher(ctx, t)
+			continue
+		}
+
+		w, err := p.newWatcher(ctx, t)
+		var rateErr *rateLimitedError
+		if errors.As(err, &rateErr) {
+			return nil, err
+		}
+		if err != nil || w == nil {
+			log.Printf("poll: %s can't poll for %s: %v", t.Login, t.Account, err)
+			continue
+		}
+		for _, repo := range setting.WatchRepos {
+			repos[repo] = append(repos[repo], w)
+		}
+	}
+	return repos, nil
+}
+
+// Poll fetches the new stargazers of the watched repos and notifies them, returns the number of new stars.
+// A repo is polled once with the token of one of its watchers, and notified to the watchers that can read it.
+func Poll(ctx context.Context) (int, error) {
+	p := &poller{now: time.Now, installations: make(map[string][]*github.Installation)}
+	repos, err := p.watchers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for name, watchers := range repos {
+		if ctx.Err() != nil {
+			break
+		}
+		// the repo is private or gone for some of the watchers
+		var repo *github.Repository
+		var stargazers []*github.Stargazer
+		for _, w := range watchers {
+			repo, stargazers, err = p.pollRepo(ctx, w.client, name)
+			var rateErr *rateLimitedError
+			if errors.As(err, &rateErr) {
+				log.Printf("poll: %s with the token of %s: %v", name, w.Login, err)
+				continue
+			}
+			if err == nil {
+				break
+			}
+			log.Printf("poll: %s with the token of %s: %v", name, w.Login, err)
+		}
+		if err != nil || repo == nil || len(stargazers) == 0 {
+			continue
+		}
+
+		// the watchers of each account, a star is enqueued once for an account
+		var accounts []*watcher
+		logins := make(map[string][]string)
+		for _, w := range watchers {
+			if !p.canRead(ctx, w, repo) {
+				continue
+			}
+			if logins[w.Account] == nil {
+				accounts = append(accounts, w)
+			}
+			logins[w.Account] = append(logins[w.Account], w.Login)
+		}
+		for i, s := range stargazers {
+			// the star count right after the star
+			r := *repo
+			r.StargazersCount = github.Ptr(repo.GetStargazersCount() - (len(stargazers) - 1 - i))
+			// recorded once for all accounts, the jobs don't record it again
+			recordStar(
+				ctx,
+				&github.StarEvent{Action: github.Ptr("created"), StarredAt: s.StarredAt, Repo: &r, Sender: s.User},
+				&cache.OutboxJob{EnqueuedAt: p.now().Unix()},
+			)
+			for _, w := range accounts {
+				if err := enqueueStar(ctx, w, logins[w.Account], r, s); err != nil {
+					log.Printf("poll: enqueue star of %s on %s: %v", s.User.GetLogin(), name, err)
+					continue
+				}
+				n++
+			}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,345 @@
+package github
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+const (
+	reportPeriod     = 7 * 24 * time.Hour
+	reportMaxRepos   = 10
+	reportTopRepos   = 3
+	reportMilestones = 5
+	// new stargazers whose profiles are looked up for the notable ones
+	reportCandidates    = 30
+	reportTopStargazers = 3
+	reportRetryDelay    = 10 * time.Minute
+)
+
+// reportStargazer is a new stargazer of a repo in the report period.
+type reportStargazer struct {
+	repo string
+	cache.StarRecord
+}
+
+type repoReport struct {
+	repo    string
+	created int
+	deleted int
+	stars   int
+}
+
+func (r *repoReport) net() int {
+	return r.created - r.deleted
+}
+
+func repoLink(repo string) string {
+	return link(repo, "https://github.com/"+repo)
+}
+
+// reportRepos summarizes the star history of the repos allowed by the setting in [from, to].
+// It also returns the new stargazers, the latest first.
+func reportRepos(
+	ctx context.Context,
+	account string,
+	setting *cache.Setting,
+	from, to time.Time,
+) ([]*repoReport, []reportStargazer, error) {
+	repos, err := cache.HistoryRepos(ctx, account)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get history repos: %w", err)
+	}
+
+	var reports []*repoReport
+	var stargazers []reportStargazer
+	for _, repo := range repos {
+		ok, err := setting.IsAllowRepoName(ctx, repo)
+		if err != nil {
+			// hidden, it may be excluded
+			log.Printf("report: get repo %s: %v", repo, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		records, err := cache.GetStarHistory(ctx, repo, from, to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get star history of %s: %w", repo, err)
+		}
+		last, err := cache.LastStarRecord(ctx, repo)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get last record of %s: %w", repo, err)
+		}
+
+		r := &repoReport{repo: repo}
+		if last != nil {
+			r.stars = last.Stars
+		}
+		for _, record := range records {
+			switch record.Action {
+			case "created":
+				r.created++
+				stargazers = append(stargazers, reportStargazer{repo: repo, StarRecord: record})
+			case "deleted":
+				r.deleted++
+			}
+		}
+		reports = append(reports, r)
+	}
+
+	slices.SortFunc(
+		reports, func(a, b *repoReport) int {
+			return cmp.Or(cmp.Compare(b.net(), a.net()), cmp.Compare(b.stars, a.stars), strings.Compare(a.repo, b.repo))
+		},
+	)
+	slices.SortFunc(
+		stargazers, func(a, b reportStargazer) int {
+			return cmp.Compare(b.At, a.At)
+		},
+	)
+	stargazers = lo.UniqBy(stargazers, func(s reportStargazer) string { return s.Sender })
+	return reports, stargazers, nil
+}
+
+type notableStargazer struct {
+	reportStargazer
+	profile cache.Profile
+	reason  string
+}
+
+// reportNotables picks the notable ones of the new stargazers by the notable rule of the setting,
+// or the ones with the most followers if there is no rule.
+func reportNotables(ctx context.Context, setting *cache.Setting, stargazers []reportStargazer) []notableStargazer {
+	var notables []notableStargazer
+	for _, record := range lo.Slice(stargazers, 0, reportCandidates) {
+		installationID, err := cache.GetRepoInstallationID(ctx, record.repo)
+		if err != nil {
+			log.Printf("report: get installation of %s: %v", record.repo, err)
+			continue
+		}
+		profile := sync.OnceValues(
+			func() (cache.Profile, error) {
+				return cache.GetProfile(ctx, installationID, record.Sender)
+			},
+		)
+		p, err := profile()
+		if err != nil {
+			log.Printf("report: get profile of %s: %v", record.Sender, err)
+			continue
+		}
+
+		reason := utils.FormatCompact(p.Followers) + " followers"
+		if setting.Notable != nil {
+			orgs := func() ([]string, error) {
+				return cache.GetOrgs(ctx, installationID, record.Sender)
+			}
+			reason = setting.Notable.Match(record.Sender, profile, orgs)
+			if reason == "" {
+				continue
+			}
+		} else if p.Followers == 0 {
+			continue
+		}
+		notables = append(notables, notableStargazer{reportStargazer: record, profile: p, reason: reason})
+	}
+
+	slices.SortStableFunc(
+		notables, func(a, b notableStargazer) int {
+			return cmp.Compare(b.profile.Followers, a.profile.Followers)
+		},
+	)
+	return lo.Slice(notables, 0, reportTopStargazers)
+}
+
+func composeReport(setting *cache.Setting, reports []*repoReport, notables []notableStargazer) (string, string) {
+	active := lo.Filter(
+		reports, func(r *repoReport, _ int) bool {
+			return r.created+r.deleted > 0
+		},
+	)
+	total := lo.SumBy(active, func(r *repoReport) int { return r.net() })
+
+	title := fmt.Sprintf("Weekly Star Report: %s stars on %d repos", formatNet(total), len(active))
+	var lines []string
+	if len(active) == 0 {
+		lines = append(lines, utils.EscapeMarkdown("No stars gained or lost this week."))
+	}
+	for _, r := range lo.Slice(active, 0, reportMaxRepos) {
+		lines = append(
+			lines, fmt.Sprintf(
+				"%s %s / %s stars \\(now **%s**\\)",
+				repoLink(r.repo),
+				formatNet(r.created),
+				utils.EscapeMarkdown(fmt.Sprintf("-%d", r.deleted)),
+				utils.EscapeMarkdown(utils.FormatNumber(r.stars)),
+			),
+		)
+	}
+	if len(active) > reportMaxRepos {
+		lines = append(lines, utils.EscapeMarkdown(fmt.Sprintf("and %d more repos", len(active)-reportMaxRepos)))
+	}
+
+	growing := lo.Filter(
+		active, func(r *repoReport, _ int) bool {
+			return r.net() > 0
+		},
+	)
+	if len(growing) > 0 {
+		names := lo.Map(
+			lo.Slice(growing, 0, reportTopRepos), func(r *repoReport, _ int) string {
+				return fmt.Sprintf("%s \\(%s\\)", repoLink(r.repo), formatNet(r.net()))
+			},
+		)
+		lines = append(lines, "", "**Top growing**: "+strings.Join(names, ", "))
+	}
+
+	if len(notables) > 0 {
+		lines = append(lines, "", "**Notable new stargazers**:")
+		for _, n := range notables {
+			lines = append(
+				lines, fmt.Sprintf(
+					"%s starred %s, %s",
+					stargazerText(nil, &n.profile),
+					repoLink(n.repo),
+					utils.EscapeMarkdown(n.reason),
+				),
+			)
+		}
+	}
+
+	// the biggest repos first
+	byStars := slices.Clone(reports)
+	slices.SortStableFunc(
+		byStars, func(a, b *repoReport) int {
+			return cmp.Compare(b.stars, a.stars)
+		},
+	)
+	var progress []string
+	for _, r := range byStars {
+		next := setting.Milestones.Next(r.stars)
+		if r.stars == 0 || next == 0 {
+			continue
+		}
+		progress = append(
+			progress, fmt.Sprintf(
+				"%s %s / %s, %s to go",
+				repoLink(r.repo),
+				utils.EscapeMarkdown(utils.FormatNumber(r.stars)),
+				utils.EscapeMarkdown(utils.FormatNumber(next)),
+				utils.EscapeMarkdown(utils.FormatNumber(next-r.stars)),
+			),
+		)
+		if len(progress) >= reportMilestones {
+			break
+		}
+	}
+	if len(progress) > 0 {
+		lines = append(lines, "", "**Next milestones**:")
+		lines = append(lines, progress...)
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+// reportChannels returns the channels selected for the report, only the ones in `retry` if it's not nil.
+func reportChannels(login string, setting *cache.Setting, retry []string) *channelGroup {
+	selected := setting.ResolveChannels(setting.Report.Channels)
+	var g channelGroup
+	for i, ns := range setting.NotifySettings {
+		if len(setting.Report.Channels) > 0 && !slices.Contains(selected, i) {
+			continue
+		}
+		channel := channelID(login, i, ns)
+		if retry != nil && !slices.Contains(retry, channel) {
+			continue
+		}
+		g.add(channel, ns)
+	}
+	return &g
+}
+
+// sendReport sends the report to the channels of the setting, only to the ones in `retry` if it's not nil.
+// It returns the channels that failed.
+func sendReport(
+	ctx context.Context,
+	t cache.ReportTarget,
+	setting *cache.Setting,
+	now time.Time,
+	retry []string,
+) ([]string, error) {
+	channels := reportChannels(t.Login, setting, retry)
+	if len(channels.channels) == 0 {
+		return nil, nil
+	}
+	reports, stargazers, err := reportRepos(ctx, t.Account, setting, now.Add(-reportPeriod), now)
+	if err != nil {
+		return nil, err
+	}
+	title, content := composeReport(setting, reports, reportNotables(ctx, setting, stargazers))
+
+	failed, errs := channels.send(ctx, title, content, false)
+	return failed, errors.Join(errs...)
+}
+
+// runReport sends the due report of the setting, and schedules the next one.
+// The channels that failed are retried later, without sending to the others again.
+func runReport(ctx context.Context, t cache.ReportTarget, now time.Time) error {
+	setting, err := cache.GetSettings(ctx, t.Account, t.Login)
+	if err == nil {
+		// the report is turned off
+		if setting == nil || setting.Report == nil {
+			return nil
+		}
+		var retry, failed []string
+		retry, err = cache.GetReportRetry(ctx, t)
+		if err == nil {
+			failed, err = sendReport(ctx, t, setting, now, retry)
+		}
+		if len(failed) > 0 {
+			if err := cache.SetReportRetry(ctx, t, failed); err != nil {
+				log.Printf("report: save retry channels of %s: %v", t.Login, err)
+			}
+		}
+	}
+	if err != nil {
+		_ = cache.ScheduleReport(ctx, t, now.Add(reportRetryDelay))
+		return err
+	}
+
+	if err := cache.ClearReportRetry(ctx, t); err != nil {
+		log.Printf("report: clear retry channels of %s: %v", t.Login, err)
+	}
+	next, _ := setting.NextReport(now)
+	return cache.ScheduleReport(ctx, t, next)
+}
+
+// SendReports sends the due weekly reports, returns the number of sent reports.
+func SendReports(ctx context.Context) (int, error) {
+	now := time.Now()
+	targets, err := cache.PopDueReports(ctx, now)
+	if err != nil {
+		return 0, fmt.Errorf("pop due reports: %w", err)
+	}
+
+	n := 0
+	for _, t := range targets {
+		err := runReport(ctx, t, now)
+		if err != nil {
+			log.Printf("report: send to %s of %s: %v", t.Login, t.Account, err)
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
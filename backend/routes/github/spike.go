@@ -0,0 +1,121 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// appended to the channel IDs of spike alerts
+const spikeSuffix = "/spike"
+
+func formatWindow(window time.Duration) string {
+	switch {
+	case window == time.Hour:
+		return "hour"
+	case window%time.Hour == 0:
+		return fmt.Sprintf("%d hours", window/time.Hour)
+	default:
+		return fmt.Sprintf("%d minutes", window/time.Minute)
+	}
+}
+
+func composeSpike(evt *github.StarEvent, stars int, baseline float64, window time.Duration) (string, string) {
+	title := fmt.Sprintf("📈 Star spike on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+	normal := "normally none"
+	if baseline > 0 {
+		normal = fmt.Sprintf("%.0f× normal", float64(stars)/baseline)
+	}
+	text := fmt.Sprintf(
+		"%s: **%d** stars in the last %s \\(%s\\)",
+		link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
+		stars,
+		utils.EscapeMarkdown(formatWindow(window)),
+		utils.EscapeMarkdown(normal),
+	)
+	return title, text
+}
+
+// sendSpikes alerts the settings whose spike rule matches the recent star rate of the repo.
+// Each repo is alerted at most once per cooldown for a login, it returns the channels that failed.
+func sendSpikes(
+	ctx context.Context,
+	evt *github.StarEvent,
+	settings map[string]*cache.Setting,
+	retry []string,
+	profile profileFunc,
+) ([]string, error) {
+	if evt.GetAction() != "created" {
+		return nil, nil
+	}
+
+	// the settings with the same window share the message
+	repo := evt.Repo.GetFullName()
+	byWindow := make(map[time.Duration]map[string]*cache.Setting)
+	for login, setting := range settings {
+		if setting.Spike == nil || !setting.IsAllowRepo(repoInfo(evt.Repo)) {
+			continue
+		}
+		w := setting.Spike.GetWindow()
+		if byWindow[w] == nil {
+			byWindow[w] = make(map[string]*cache.Setting)
+		}
+		byWindow[w][login] = setting
+	}
+
+	var mu sync.Mutex
+	var failed []string
+	wg := pool.New().WithErrors().WithContext(ctx)
+	for window, group := range byWindow {
+		stars, baseline, err := cache.StarRate(ctx, repo, time.Now(), window)
+		if err != nil {
+			log.Printf("spike: get star rate of %s: %v", repo, err)
+			continue
+		}
+
+		title, content := composeSpike(evt, stars, baseline, window)
+		n := &notification{
+			kind:           cache.RouteSpike,
+			account:        starAccount(evt),
+			repo:           evt.Repo,
+			sender:         evt.Sender,
+			installationID: evt.Installation.GetID(),
+			title:          title,
+			content:        content,
+			urgent:         true,
+			channelSuffix:  spikeSuffix,
+		}
+		wg.Go(
+			func(ctx context.Context) error {
+				f, err := notifyClaimed(
+					ctx, group, n, retry, profile, func(login string, setting *cache.Setting) bool {
+						if !setting.Spike.Matches(stars, baseline) {
+							return false
+						}
+						return claimAlert(ctx, cache.RouteSpike, repo, login, setting.Spike.GetCooldown())
+					}, func(login string) {
+						_ = cache.ReleaseAlert(ctx, cache.RouteSpike, repo, login)
+					},
+				)
+				mu.Lock()
+				failed = append(failed, f...)
+				mu.Unlock()
+				return err
+			},
+		)
+	}
+	err := wg.Wait()
+
+	if err != nil {
+		return failed, fmt.Errorf("send spike: %w", err)
+	}
+	return nil, nil
+}
@@ -0,0 +1,112 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v84/github"
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/suspicion"
+	"github.com/j178/github_stargazer/backend/utils"
+)
+
+// appended to the channel IDs of suspicion alerts
+const suspicionSuffix = "/suspicion"
+
+func composeSuspicion(evt *github.StarEvent, r suspicion.Report) (string, string) {
+	title := fmt.Sprintf("🚨 Suspicious stars on %s", utils.EscapeMarkdown(evt.Repo.GetFullName()))
+	lines := []string{
+		fmt.Sprintf(
+			"%s: **%s** suspicion \\(score %s\\)",
+			link(evt.Repo.GetFullName(), evt.Repo.GetHTMLURL()),
+			r.Level,
+			utils.EscapeMarkdown(fmt.Sprintf("%.2f", r.Score)),
+		),
+		utils.EscapeMarkdown(
+			fmt.Sprintf(
+				"%d of the latest %d stargazers in %d days look fake, up to %d stars in an hour.",
+				r.Suspicious, r.Analyzed, r.Days, r.Burst,
+			),
+		),
+	}
+	if len(r.Clusters) > 0 {
+		clusters := lo.Map(
+			lo.Slice(r.Clusters, 0, 3), func(c suspicion.Cluster, _ int) string {
+				return fmt.Sprintf("%d on %s", c.Count, c.Date)
+			},
+		)
+		lines = append(lines, utils.EscapeMarkdown("Accounts created together: "+strings.Join(clusters, ", ")))
+	}
+	return title, strings.Join(lines, "\n")
+}
+
+// sendSuspicion alerts the settings whose suspicion rule matches the recent stargazers of the repo.
+// The repo is checked at most once an hour, and alerted at most once a day for a login.
+// It returns the channels that failed.
+func sendSuspicion(
+	ctx context.Context,
+	evt *github.StarEvent,
+	settings map[string]*cache.Setting,
+	retry []string,
+	profile profileFunc,
+) ([]string, error) {
+	if evt.GetAction() != "created" {
+		return nil, nil
+	}
+	repo := evt.Repo.GetFullName()
+	group := lo.PickBy(
+		settings, func(_ string, setting *cache.Setting) bool {
+			return setting.Suspicion != nil && setting.IsAllowRepo(repoInfo(evt.Repo))
+		},
+	)
+	if len(group) == 0 {
+		return nil, nil
+	}
+
+	// the retries of failed alerts skip the throttle
+	if retry != nil {
+		if !lo.SomeBy(retry, func(c string) bool { return strings.HasSuffix(c, suspicionSuffix) }) {
+			return nil, nil
+		}
+	} else if ok, err := cache.ClaimSuspicionCheck(ctx, repo); err != nil || !ok {
+		return nil, err
+	}
+
+	report, err := suspicion.Analyze(ctx, evt.Installation.GetID(), repo, cache.SuspicionDays, time.Now())
+	if err != nil {
+		log.Printf("suspicion: analyze %s: %v", repo, err)
+		return nil, nil
+	}
+
+	title, content := composeSuspicion(evt, report)
+	n := &notification{
+		kind:           cache.RouteSuspicion,
+		account:        starAccount(evt),
+		repo:           evt.Repo,
+		sender:         evt.Sender,
+		installationID: evt.Installation.GetID(),
+		title:          title,
+		content:        content,
+		urgent:         true,
+		channelSuffix:  suspicionSuffix,
+	}
+	failed, err := notifyClaimed(
+		ctx, group, n, retry, profile, func(login string, setting *cache.Setting) bool {
+			if !setting.Suspicion.Matches(report.Score, report.Analyzed) {
+				return false
+			}
+			return claimAlert(ctx, cache.RouteSuspicion, repo, login, setting.Suspicion.GetCooldown())
+		}, func(login string) {
+			_ = cache.ReleaseAlert(ctx, cache.RouteSuspicion, repo, login)
+		},
+	)
+	if err != nil {
+		return failed, fmt.Errorf("send suspicion: %w", err)
+	}
+	return nil, nil
+}
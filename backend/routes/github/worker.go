@@ -0,0 +1,255 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/go-github/v84/github"
+
+	"github.com/j178/github_stargazer/backend/cache"
+	"github.com/j178/github_stargazer/backend/routes"
+)
+
+const (
+	maxAttempts  = 5
+	retryBackoff = 30 * time.Second
+	workerBatch  = 10
+	workerBlock  = 5 * time.Second
+	// Vercel functions are killed after 10 seconds on the hobby plan
+	cronBudget = 8 * time.Second
+	// GitHub gives up on a webhook delivery after 10 seconds
+	eventBudget = 5 * time.Second
+)
+
+var consumerName = func() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}()
+
+func processJob(ctx context.Context, job *cache.OutboxJob) ([]string, error) {
+	event, err := github.ParseWebHook(job.Event, job.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch evt := event.(type) {
+	case *github.StarEvent:
+		return processStar(ctx, evt, job)
+	default:
+		return processEvent(ctx, event, job.Payload, job.Retry)
+	}
+}
+
+// publishLive pushes the delivery result of the job to the live stream of the account.
+func publishLive(ctx context.Context, job *cache.OutboxJob, status string, failed []string, err error) {
+	var payload struct {
+		Action     string `json:"action"`
+		Repository struct {
+			FullName string `json:"full_name"`
+		} `json:"repository"`
+		Sender struct {
+			Login string `json:"login"`
+		} `json:"sender"`
+	}
+	_ = json.Unmarshal(job.Payload, &payload)
+
+	msg := cache.LiveMessage{
+		Type:       cache.LiveEvent,
+		DeliveryID: job.DeliveryID,
+		Event:      job.Event,
+		Action:     payload.Action,
+		Repo:       payload.Repository.FullName,
+		Sender:     payload.Sender.Login,
+		Status:     status,
+		Failed:     failed,
+		Attempts:   job.Attempts,
+		At:         time.Now().Unix(),
+	}
+	if job.Event == "star" {
+		msg.Type = cache.LiveStar
+	}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	if err := cache.PublishLive(ctx, job.Account, msg); err != nil {
+		log.Printf("outbox: publish live %s: %v", job.DeliveryID, err)
+	}
+}
+
+func handleEntry(ctx context.Context, entry cache.OutboxEntry) {
+	job := entry.Job
+	if job.Event == "" {
+		log.Printf("outbox: drop malformed job %s", entry.ID)
+		_ = cache.AckOutbox(ctx, entry.ID)
+		return
+	}
+
+	failed, err := processJob(ctx, &job)
+	switch {
+	case err == nil:
+		if err := cache.FinishDelivery(ctx, job.DeliveryID); err != nil {
+			log.Printf("outbox: finish delivery %s: %v", job.DeliveryID, err)
+		}
+		publishLive(ctx, &job, "delivered", nil, nil)
+	case job.Attempts+1 >= maxAttempts:
+		job.Attempts++
+		job.Retry = failed
+		job.LastError = err.Error()
+		log.Printf("outbox: delivery %s dead after %d attempts: %v", job.DeliveryID, job.Attempts, err)
+		if err := cache.DeadLetter(ctx, job); err != nil {
+			log.Printf("outbox: dead letter %s: %v", job.DeliveryID, err)
+			// keep it in the stream, so that it is claimed again later
+			return
+		}
+		if err := cache.FailDelivery(ctx, job.DeliveryID, failed); err != nil {
+			log.Printf("outbox: fail delivery %s: %v", job.DeliveryID, err)
+		}
+		publishLive(ctx, &job, "dead", failed, err)
+	default:
+		job.Attempts++
+		job.Retry = failed
+		job.LastError = err.Error()
+		at := time.Now().Add(retryBackoff << (job.Attempts - 1))
+		log.Printf("outbox: delivery %s failed, retry at %s: %v", job.DeliveryID, at.Format(time.RFC3339), err)
+		if err := cache.ScheduleRetry(ctx, job, at); err != nil {
+			log.Printf("outbox: schedule retry %s: %v", job.DeliveryID, err)
+			return
+		}
+		publishLive(ctx, &job, "retrying", failed, err)
+	}
+
+	if err := cache.AckOutbox(ctx, entry.ID); err != nil {
+		log.Printf("outbox: ack %s: %v", entry.ID, err)
+	}
+}
+
+// work reads a batch of jobs and processes them, returns the number of processed jobs.
+func work(ctx context.Context, block time.Duration) (int, error) {
+	if _, err := cache.PromoteRetries(ctx, time.Now()); err != nil {
+		return 0, fmt.Errorf("promote retries: %w", err)
+	}
+
+	entries, err := cache.ReadOutbox(ctx, consumerName, workerBatch, block)
+	if err != nil {
+		return 0, fmt.Errorf("read outbox: %w", err)
+	}
+	for _, entry := range entries {
+		handleEntry(ctx, entry)
+	}
+	return len(entries), nil
+}
+
+type periodicTask struct {
+	interval time.Duration
+	run      func(ctx context.Context) (int, error)
+}
+
+// periodicTasks are run by the worker, and by Vercel Cron through `/api/cron/:task`.
+var periodicTasks = map[string]periodicTask{
+	"outbox":   {interval: 0, run: Drain},
+	"digest":   {interval: time.Minute, run: FlushDigests},
+	"backfill": {interval: time.Minute, run: Backfill},
+	"report":   {interval: 10 * time.Minute, run: SendReports},
+	"poll":     {interval: 5 * time.Minute, run: Poll},
+}
+
+// RunWorker drains the outbox continuously and runs the periodic tasks, until the context is canceled.
+func RunWorker(ctx context.Context) error {
+	lastRun := make(map[string]time.Time)
+	for {
+		_, err := work(ctx, workerBlock)
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("outbox: %v", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(workerBlock):
+			}
+		}
+
+		for name, task := range periodicTasks {
+			// the outbox is drained above
+			if task.interval == 0 || time.Since(lastRun[name]) < task.interval {
+				continue
+			}
+			lastRun[name] = time.Now()
+			if _, err := task.run(ctx); err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+// Drain processes the jobs in the outbox until it's empty or the context is done.
+func Drain(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		n, err := work(ctx, 0)
+		total += n
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return total, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	return total, nil
+}
+
+// runDueTasks drains the outbox and runs the periodic tasks that are due, within the budget of a webhook delivery.
+// Vercel Cron runs only once a day on the hobby plan, the webhook deliveries keep the tasks going instead,
+// and the crons are the backstop.
+func runDueTasks(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, eventBudget)
+	defer cancel()
+
+	if _, err := Drain(ctx); err != nil {
+		log.Printf("outbox: %v", err)
+	}
+	for name, task := range periodicTasks {
+		if task.interval == 0 || ctx.Err() != nil {
+			continue
+		}
+		// run by another instance recently
+		ok, err := cache.ClaimTask(ctx, name, task.interval)
+		if err != nil || !ok {
+			continue
+		}
+		if _, err := task.run(ctx); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+	}
+}
+
+// OnCron is called by Vercel Cron to run a periodic task.
+func OnCron(c *gin.Context) {
+	name := c.Param("task")
+	task, ok := periodicTasks[name]
+	if !ok {
+		routes.Abort(c, http.StatusNotFound, nil, fmt.Sprintf("unknown task: %s", name))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, cronBudget)
+	defer cancel()
+
+	n, err := task.run(ctx)
+	if err != nil {
+		routes.Abort(c, http.StatusInternalServerError, err, name)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"processed": n})
+}
@@ -0,0 +1,234 @@
+package suspicion
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+// Purchased stars come in bursts from brand-new, empty accounts created around the same time.
+// The recent stargazers of a repo are scored by these signals of their profiles, and the repo is scored
+// by the share of the suspicious ones, weighted by how bursty the stars are.
+//
+// The REST API doesn't tell whether the avatar is the default identicon, the avatars are fetched to tell it.
+
+const (
+	// the latest stargazers analyzed
+	MaxAnalyzed = 100
+	// a stargazer is suspicious with at least this score
+	SuspiciousScore = 0.6
+	// accounts created in the same day with at least this many others are clustered
+	clusterSize = 3
+)
+
+type Stargazer struct {
+	Login     string   `json:"login"`
+	StarredAt int64    `json:"starred_at"`
+	Score     float64  `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+// Cluster is a group of stargazers whose accounts were created on the same day.
+type Cluster struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type Report struct {
+	Repo       string `json:"repo"`
+	Days       int    `json:"days"`
+	Stars      int    `json:"stars"`
+	Analyzed   int    `json:"analyzed"`
+	Suspicious int    `json:"suspicious"`
+	// Most stars in an hour
+	Burst int `json:"burst"`
+	// 0 to 1
+	Score      float64     `json:"score"`
+	Level      string      `json:"level"`
+	Clusters   []Cluster   `json:"clusters"`
+	Stargazers []Stargazer `json:"stargazers"`
+}
+
+func level(score float64) string {
+	switch {
+	case score >= 0.5:
+		return "high"
+	case score >= 0.25:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// burst returns the most stars in an hour, the records are sorted by time.
+func burst(records []cache.StarRecord) int {
+	most := 0
+	start := 0
+	for end := range records {
+		for records[end].At-records[start].At >= int64(time.Hour/time.Second) {
+			start++
+		}
+		most = max(most, end-start+1)
+	}
+	return most
+}
+
+func scoreStargazer(record cache.StarRecord, p cache.Profile, defaultAvatar bool, clustered int) Stargazer {
+	s := Stargazer{Login: record.Sender, StarredAt: record.At, Reasons: []string{}}
+	add := func(score float64, reason string) {
+		s.Score += score
+		s.Reasons = append(s.Reasons, reason)
+	}
+
+	age := time.Unix(record.At, 0).Sub(time.Unix(p.CreatedAt, 0))
+	switch {
+	case age < 7*24*time.Hour:
+		add(0.35, fmt.Sprintf("account created %d days before starring", int(age.Hours()/24)))
+	case age < 30*24*time.Hour:
+		add(0.2, fmt.Sprintf("account created %d days before starring", int(age.Hours()/24)))
+	}
+	if p.PublicRepos == 0 {
+		add(0.2, "no public repos")
+	}
+	if p.Followers == 0 {
+		add(0.15, "no followers")
+	}
+	if p.Name == "" && p.Bio == "" && p.Company == "" && p.Location == "" && p.Blog == "" {
+		add(0.15, "empty profile")
+	}
+	if defaultAvatar {
+		add(0.1, "default avatar")
+	}
+	if clustered >= clusterSize {
+		add(0.15, fmt.Sprintf("created on the same day as %d other stargazers", clustered))
+	}
+	s.Score = min(s.Score, 1)
+	return s
+}
+
+// Score scores the star records of the repo, sorted by time, with the profiles of the stargazers,
+// and the stargazers known to have the default avatar.
+// Only the latest MaxAnalyzed stargazers with a profile are analyzed.
+func Score(
+	repo string,
+	days int,
+	records []cache.StarRecord,
+	profiles map[string]cache.Profile,
+	defaultAvatars map[string]bool,
+) Report {
+	stars := lo.Filter(
+		records, func(r cache.StarRecord, _ int) bool {
+			return r.Action == "created"
+		},
+	)
+	report := Report{
+		Repo:       repo,
+		Days:       days,
+		Stars:      len(stars),
+		Burst:      burst(stars),
+		Clusters:   []Cluster{},
+		Stargazers: []Stargazer{},
+	}
+
+	// the latest star of each stargazer
+	latest := slices.Clone(stars)
+	slices.Reverse(latest)
+	latest = lo.UniqBy(latest, func(r cache.StarRecord) string { return r.Sender })
+	latest = lo.Filter(
+		latest, func(r cache.StarRecord, _ int) bool {
+			_, ok := profiles[r.Sender]
+			return ok
+		},
+	)
+	latest = lo.Slice(latest, 0, MaxAnalyzed)
+	report.Analyzed = len(latest)
+	if report.Analyzed == 0 {
+		report.Level = level(0)
+		return report
+	}
+
+	created := lo.CountValuesBy(
+		latest, func(r cache.StarRecord) string {
+			return time.Unix(profiles[r.Sender].CreatedAt, 0).UTC().Format(time.DateOnly)
+		},
+	)
+	for date, count := range created {
+		if count > clusterSize {
+			report.Clusters = append(report.Clusters, Cluster{Date: date, Count: count})
+		}
+	}
+	slices.SortFunc(
+		report.Clusters, func(a, b Cluster) int {
+			return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Date, b.Date))
+		},
+	)
+
+	for _, r := range latest {
+		p := profiles[r.Sender]
+		date := time.Unix(p.CreatedAt, 0).UTC().Format(time.DateOnly)
+		s := scoreStargazer(r, p, defaultAvatars[r.Sender], created[date]-1)
+		if s.Score >= SuspiciousScore {
+			report.Suspicious++
+			report.Stargazers = append(report.Stargazers, s)
+		}
+	}
+	slices.SortStableFunc(
+		report.Stargazers, func(a, b Stargazer) int {
+			return cmp.Compare(b.Score, a.Score)
+		},
+	)
+
+	ratio := float64(report.Suspicious) / float64(report.Analyzed)
+	burstShare := float64(report.Burst) / float64(report.Stars)
+	report.Score = ratio * (0.7 + 0.3*burstShare)
+	report.Level = level(report.Score)
+	return report
+}
+
+// Analyze scores the stargazers of the repo in the recent days, the profiles are fetched with the installation token.
+func Analyze(ctx context.Context, installationID int64, repo string, days int, now time.Time) (Report, error) {
+	records, err := cache.GetStarHistory(ctx, repo, now.AddDate(0, 0, -days), now)
+	if err != nil {
+		return Report{}, fmt.Errorf("get star history: %w", err)
+	}
+
+	logins := lo.FilterMap(
+		records, func(r cache.StarRecord, _ int) (string, bool) {
+			return r.Sender, r.Action == "created"
+		},
+	)
+	slices.Reverse(logins)
+	logins = lo.Slice(lo.Uniq(logins), 0, MaxAnalyzed)
+
+	var mu sync.Mutex
+	profiles := make(map[string]cache.Profile, len(logins))
+	defaultAvatars := make(map[string]bool)
+	wg := pool.New().WithMaxGoroutines(10)
+	for _, login := range logins {
+		wg.Go(
+			func() {
+				p, err := cache.GetProfile(ctx, installationID, login)
+				if err != nil {
+					return
+				}
+				// unknown if the avatar can't be fetched
+				isDefault, _ := cache.IsDefaultAvatar(ctx, p.AvatarURL)
+				mu.Lock()
+				profiles[login] = p
+				defaultAvatars[login] = isDefault
+				mu.Unlock()
+			},
+		)
+	}
+	wg.Wait()
+
+	return Score(repo, days, records, profiles, defaultAvatars), nil
+}
@@ -0,0 +1,165 @@
+package suspicion
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/j178/github_stargazer/backend/cache"
+)
+
+var start = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func star(login string, at time.Duration) cache.StarRecord {
+	return cache.StarRecord{Action: "created", Sender: login, At: start.Add(at).Unix()}
+}
+
+// established is a profile that shows none of the signals, created on the day of `n`.
+func established(login string, n int) cache.Profile {
+	return cache.Profile{
+		Login:       login,
+		Name:        login,
+		Followers:   10,
+		PublicRepos: 5,
+		CreatedAt:   start.AddDate(-5, 0, n).Unix(),
+	}
+}
+
+// fresh is an empty profile created `days` before the start.
+func fresh(login string, days int) cache.Profile {
+	return cache.Profile{Login: login, CreatedAt: start.AddDate(0, 0, -days).Unix()}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name           string
+		records        []cache.StarRecord
+		profiles       []cache.Profile
+		defaultAvatars []string
+		// Stars, Analyzed, Suspicious, Burst
+		counts     [4]int
+		score      float64
+		level      string
+		clusters   int
+		suspicious []string
+	}{
+		{
+			name:   "no stars",
+			counts: [4]int{0, 0, 0, 0},
+			level:  "low",
+		},
+		{
+			name:    "no profiles",
+			records: []cache.StarRecord{star("a", 0), star("b", time.Minute)},
+			counts:  [4]int{2, 0, 0, 2},
+			level:   "low",
+		},
+		{
+			name:     "established stargazers",
+			records:  []cache.StarRecord{star("a", 0), star("b", 24*time.Hour)},
+			profiles: []cache.Profile{established("a", 0), established("b", 1)},
+			counts:   [4]int{2, 2, 0, 1},
+			level:    "low",
+		},
+		{
+			name: "burst of new empty accounts",
+			records: []cache.StarRecord{
+				star("a", 0), star("b", time.Minute), star("c", 2*time.Minute), star("d", 3*time.Minute),
+			},
+			profiles:       []cache.Profile{fresh("a", 1), fresh("b", 1), fresh("c", 1), fresh("d", 1)},
+			defaultAvatars: []string{"a", "b", "c", "d"},
+			counts:         [4]int{4, 4, 4, 4},
+			score:          1,
+			level:          "high",
+			clusters:       1,
+			suspicious:     []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "some new empty accounts",
+			records: []cache.StarRecord{
+				star("a", 0), star("b", 24*time.Hour), star("c", 48*time.Hour), star("d", 72*time.Hour),
+				star("x", 96*time.Hour), star("y", 96*time.Hour+time.Minute),
+			},
+			profiles: []cache.Profile{
+				established("a", 0), established("b", 1), established("c", 2), established("d", 3),
+				fresh("x", -2), fresh("y", -2),
+			},
+			counts:     [4]int{6, 6, 2, 2},
+			score:      2.0 / 6 * (0.7 + 0.3*2/6),
+			level:      "medium",
+			suspicious: []string{"x", "y"},
+		},
+		{
+			name:     "borderline without default avatar",
+			records:  []cache.StarRecord{star("a", 0)},
+			profiles: []cache.Profile{{Login: "a", Name: "A", CreatedAt: start.AddDate(0, 0, -10).Unix()}},
+			counts:   [4]int{1, 1, 0, 1},
+			level:    "low",
+		},
+		{
+			name:           "borderline with default avatar",
+			records:        []cache.StarRecord{star("a", 0)},
+			profiles:       []cache.Profile{{Login: "a", Name: "A", CreatedAt: start.AddDate(0, 0, -10).Unix()}},
+			defaultAvatars: []string{"a"},
+			counts:         [4]int{1, 1, 1, 1},
+			score:          1,
+			level:          "high",
+			suspicious:     []string{"a"},
+		},
+		{
+			name: "unstars are not counted",
+			records: []cache.StarRecord{
+				star("a", 0),
+				{Action: "deleted", Sender: "a", At: start.Add(time.Minute).Unix()},
+				star("a", 2*time.Minute),
+			},
+			profiles: []cache.Profile{fresh("a", 1)},
+			counts:   [4]int{2, 1, 1, 2},
+			score:    1,
+			level:    "high",
+			// the latest star
+			suspicious: []string{"a"},
+		},
+		{
+			name: "only the latest stargazers",
+			records: append(
+				[]cache.StarRecord{star("old", 0)},
+				lo.Times(MaxAnalyzed, func(i int) cache.StarRecord { return star(fmt.Sprint(i), time.Duration(i+1)*time.Hour) })...,
+			),
+			profiles: append(
+				[]cache.Profile{fresh("old", 1)},
+				lo.Times(MaxAnalyzed, func(i int) cache.Profile { return established(fmt.Sprint(i), i) })...,
+			),
+			counts: [4]int{MaxAnalyzed + 1, MaxAnalyzed, 0, 1},
+			level:  "low",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				profiles := lo.KeyBy(tt.profiles, func(p cache.Profile) string { return p.Login })
+				defaultAvatars := lo.SliceToMap(tt.defaultAvatars, func(login string) (string, bool) { return login, true })
+				r := Score("owner/repo", 7, tt.records, profiles, defaultAvatars)
+
+				if counts := [4]int{r.Stars, r.Analyzed, r.Suspicious, r.Burst}; counts != tt.counts {
+					t.Errorf("stars, analyzed, suspicious, burst = %v, want %v", counts, tt.counts)
+				}
+				if math.Abs(r.Score-tt.score) > 1e-9 || r.Level != tt.level {
+					t.Errorf("score = %v %s, want %v %s", r.Score, r.Level, tt.score, tt.level)
+				}
+				if len(r.Clusters) != tt.clusters {
+					t.Errorf("clusters = %v, want %d", r.Clusters, tt.clusters)
+				}
+				logins := lo.Map(r.Stargazers, func(s Stargazer, _ int) string { return s.Login })
+				slices.Sort(logins)
+				if !slices.Equal(logins, tt.suspicious) && len(logins)+len(tt.suspicious) > 0 {
+					t.Errorf("suspicious = %v, want %v", logins, tt.suspicious)
+				}
+			},
+		)
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,43 @@ func EscapeMarkdown(text string) string {
 	return markdownReplacer.Replace(text)
 }
 
+// FormatNumber formats the number with thousands separators, e.g. 4210 -> "4,210".
+func FormatNumber(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String()
+}
+
+// FormatCompact formats the number in a short form, e.g. 1234 -> "1.2k", 200000 -> "200k".
+func FormatCompact(n int) string {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	var v float64
+	var unit string
+	switch {
+	case abs >= 1_000_000:
+		v, unit = float64(n)/1_000_000, "m"
+	case abs >= 1_000:
+		v, unit = float64(n)/1_000, "k"
+	default:
+		return strconv.Itoa(n)
+	}
+	s := strconv.FormatFloat(v, 'f', 1, 64)
+	return strings.TrimSuffix(s, ".0") + unit
+}
+
 func RequestScheme(c *gin.Context) string {
 	// Can't use `r.Request.URL.Scheme`
 	// See: https://groups.google.com/forum/#!topic/golang-nuts/pMUkBlQBDF0
@@ -1,18 +1,46 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 
 	"github.com/j178/github_stargazer/api"
 	"github.com/j178/github_stargazer/backend/config"
+	"github.com/j178/github_stargazer/backend/routes/github"
 )
 
 func main() {
+	mode := flag.String("mode", "all", "what to run: server, worker or all")
+	flag.Parse()
+
 	_ = godotenv.Load(".env", ".env.local")
 	config.Load()
 
-	log.Fatal(http.ListenAndServe(":8080", api.Handler()))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch *mode {
+	case "server":
+		log.Fatal(http.ListenAndServe(":8080", api.Handler()))
+	case "worker":
+		log.Println("outbox worker started")
+		if err := github.RunWorker(ctx); err != nil && ctx.Err() == nil {
+			log.Fatal(err)
+		}
+	case "all":
+		go func() {
+			if err := github.RunWorker(ctx); err != nil && ctx.Err() == nil {
+				log.Fatal(err)
+			}
+		}()
+		log.Fatal(http.ListenAndServe(":8080", api.Handler()))
+	default:
+		log.Fatalf("unknown mode: %s", *mode)
+	}
 }